@@ -4,24 +4,38 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // nolint: gci
 
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/auth"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/logger"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/admin"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/certs"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/grpcsrv"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/rest"
+	boltstorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/bolt"
+	cachestorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/cache"
 	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
 	sqlstorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 )
 
-var configFile string
+var (
+	configFile    string
+	migrationsDir string
+)
 
 func init() {
 	flag.StringVar(&configFile, "config", "./configs/calendar.json", "Path to configuration file")
+	flag.StringVar(&migrationsDir, "migrations", "./migrations", "Directory for new migrations of migrate create")
 }
 
 func main() {
@@ -32,22 +46,105 @@ func main() {
 		return
 	}
 
+	if flag.Arg(0) == "migrate" {
+		runMigrate(flag.Args()[1:])
+		return
+	}
+
 	cfg, err := config.NewCalendar(configFile)
 	if err != nil {
 		log.Fatalf("can't get config: %v", err)
 	}
 
-	logg, err := logger.New(cfg.Logger.Level, cfg.Logger.FilePath)
+	logg, err := logger.New(int8(cfg.Logger.Level), cfg.Logger.FilePath, cfg.Logger.Encoding)
 	if err != nil {
 		log.Fatalf("can't start logger %v\n", err)
 	}
+	defer logg.Sync() // nolint: errcheck
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	calendar := app.New(logg, startStorageService(ctx, cfg.Database))
-	restServer := rest.NewServer(rest.NewAPI(calendar), cfg.RestServer.Host, cfg.RestServer.Port, logg)
-	grpcServer := grpcsrv.NewServer(grpcsrv.NewAPI(calendar), cfg.GrpcServer.Host, cfg.GrpcServer.Port, logg)
+	tracer, err := tracing.Start(ctx, "calendar", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("can't start tracing: %v", err)
+	}
+	defer shutdownTracing(tracer, logg)
+
+	authenticator, err := auth.New(cfg.Auth)
+	if err != nil {
+		log.Fatalf("can't start authentication: %v", err)
+	}
+
+	restCerts, err := certs.New(cfg.RestServer.TLS)
+	if err != nil {
+		log.Fatalf("can't load rest server certificates: %v", err)
+	}
+	grpcCerts, err := certs.New(cfg.GrpcServer.TLS)
+	if err != nil {
+		log.Fatalf("can't load gRPC server certificates: %v", err)
+	}
+
+	baseStorage := startStorageService(ctx, cfg.Database)
+	var storage app.Storage = metrics.NewStorage(baseStorage)
+	if cfg.Cache.Enabled {
+		cache := cachestorage.New(storage, cfg.Cache.Capacity, time.Duration(cfg.Cache.TTLInSec)*time.Second)
+		metrics.RegisterCache(cache.Stats)
+		// the scheduler and other instances write to postgres too, their changes come by notifications
+		if source, ok := baseStorage.(cachestorage.ChangeSource); ok {
+			go source.ListenChanges(ctx, cache.Changed)
+		}
+		storage = cache
+	}
+	calendar := app.New(logg, storage)
+	webhookTimeout := time.Duration(cfg.Webhooks.TimeoutInSec) * time.Second
+	webhookClient := app.NewWebhookClient(webhookTimeout)
+	if cfg.Webhooks.AllowPrivateTargets {
+		calendar.AllowPrivateWebhooks()
+		webhookClient = &http.Client{Timeout: webhookTimeout} // nolint: exhaustivestruct
+	}
+	webhooks := app.NewWebhookDispatcher(
+		logg,
+		calendar,
+		storage,
+		webhookClient,
+		cfg.Webhooks.Workers,
+		cfg.Webhooks.MaxAttempts,
+		time.Duration(cfg.Webhooks.BackoffInMs)*time.Millisecond,
+	)
+	grpcAPI := grpcsrv.NewAPI(calendar)
+	gateway, err := grpcsrv.NewGateway(ctx, grpcAPI)
+	if err != nil {
+		log.Fatalf("can't create gateway: %v", err)
+	}
+
+	restServer := rest.NewServer(
+		rest.NewAPI(calendar),
+		calendar,
+		cfg.RestServer.Host,
+		cfg.RestServer.Port,
+		logg,
+		rest.WithAccessLogSampling(cfg.RestServer.AccessLog.SampleEvery),
+		rest.WithSlowRequestThreshold(time.Duration(cfg.RestServer.AccessLog.SlowThresholdInMs)*time.Millisecond),
+		rest.WithRateLimit(cfg.RestServer.Limits.RatePerSec, cfg.RestServer.Limits.Burst),
+		rest.WithMaxBodySize(cfg.RestServer.Limits.MaxBodyBytes),
+		rest.WithRequestTimeout(time.Duration(cfg.RestServer.Limits.RequestTimeoutInMs)*time.Millisecond),
+		rest.WithAuthenticator(authenticator),
+		rest.WithTLS(restCerts),
+		rest.WithGateway("/v1/", gateway),
+	)
+	grpcServer := grpcsrv.NewServer(
+		grpcAPI,
+		cfg.GrpcServer.Host,
+		cfg.GrpcServer.Port,
+		logg,
+		grpcsrv.WithRateLimit(cfg.GrpcServer.Limits.RatePerSec, cfg.GrpcServer.Limits.Burst),
+		grpcsrv.WithMaxRecvMsgSize(int(cfg.GrpcServer.Limits.MaxBodyBytes)),
+		grpcsrv.WithRequestTimeout(time.Duration(cfg.GrpcServer.Limits.RequestTimeoutInMs)*time.Millisecond),
+		grpcsrv.WithAuthenticator(authenticator),
+		grpcsrv.WithTLS(grpcCerts),
+	)
+	adminServer := startAdminServer(ctx, cfg, logg, storage)
 
 	go func() {
 		signals := make(chan os.Signal, 1)
@@ -69,12 +166,25 @@ func main() {
 		if err := grpcServer.Stop(); err != nil {
 			logg.Error("failed to stop gRPC server: " + err.Error())
 		}
+
+		if adminServer != nil {
+			if err := adminServer.Stop(ctx); err != nil {
+				logg.Error("failed to stop admin server: " + err.Error())
+			}
+		}
 	}()
 
+	go reloadCertsOnHangup(ctx, logg, restCerts, grpcCerts)
+
 	logg.Info("calendar is running...")
 	var wg sync.WaitGroup
 
-	wg.Add(2)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		webhooks.Run(ctx)
+	}()
+
 	go func() {
 		defer wg.Done()
 		startRESTServer(ctx, restServer, logg)
@@ -87,6 +197,72 @@ func main() {
 	wg.Wait()
 }
 
+func shutdownTracing(tracer *tracing.Provider, logg app.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logg.Error("failed to flush spans: " + err.Error())
+	}
+}
+
+// reloadCertsOnHangup rereads certificates on SIGHUP, open connections are not dropped.
+func reloadCertsOnHangup(ctx context.Context, logg app.Logger, reloaders ...*certs.Reloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+		for _, r := range reloaders {
+			if r == nil {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logg.Error("failed to reload certificates: " + err.Error())
+				continue
+			}
+			logg.Info("certificates are reloaded")
+		}
+	}
+}
+
+// startAdminServer serves metrics and probes on a separate port, the public API doesn't expose them.
+func startAdminServer(ctx context.Context, cfg config.Calendar, logg app.Logger, storage app.Storage) *admin.Server {
+	if cfg.Admin.Port == "" {
+		return nil
+	}
+
+	s := admin.NewServer(
+		cfg.Admin.Host,
+		cfg.Admin.Port,
+		logg,
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				"storage_driver": cfg.Database.StorageDriver(),
+				"cache_enabled":  cfg.Cache.Enabled,
+			}
+		},
+		admin.Probe{Name: "storage", Check: func(ctx context.Context) error {
+			if p, ok := storage.(app.Pinger); ok {
+				return p.Ping(ctx)
+			}
+			return nil
+		}},
+	)
+
+	go func() {
+		logg.Info("starting admin server at " + s.Address)
+		if err := s.Start(ctx); err != nil {
+			log.Fatalf("failed to start admin server: " + err.Error())
+		}
+	}()
+	return s
+}
+
 func startRESTServer(ctx context.Context, s *rest.Server, logg app.Logger) {
 	logg.Info("starting REST server at " + s.Address)
 	if err := s.Start(ctx); err != nil {
@@ -103,14 +279,24 @@ func startGRPCServer(ctx context.Context, s *grpcsrv.Server, logg app.Logger) {
 
 func startStorageService(ctx context.Context, cfg config.DBConf) app.Storage {
 	var s app.Storage
-	if cfg.InMem {
+	switch cfg.StorageDriver() {
+	case config.DriverMemory:
 		s = memorystorage.New()
-	} else {
-		sqlStore, err := sqlstorage.New(ctx, cfg.Username, cfg.Password, cfg.Address, cfg.DBName)
+	case config.DriverBolt:
+		boltStore, err := boltstorage.New(cfg.Path)
+		if err != nil {
+			log.Fatalf("failed to open storage file: " + err.Error())
+		}
+		s = boltStore
+	case config.DriverPostgres:
+		sqlStore, err := sqlstorage.New(ctx, cfg.Username, cfg.Password, cfg.Address, cfg.DBName, sqlstorage.ConfOptions(cfg)...)
 		if err != nil {
 			log.Fatalf("failed to start storage connection: " + err.Error())
 		}
+		metrics.RegisterRouting(sqlStore.RoutingStats)
 		s = sqlStore
+	default:
+		log.Fatalf("unknown storage driver: " + cfg.Driver)
 	}
 	return s
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	sqlstorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/sql"
+)
+
+const migrateUsage = "usage: calendar [-config file] migrate up|down|status|create <name>"
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			log.Fatal(migrateUsage)
+		}
+		path, err := sqlstorage.CreateMigration(migrationsDir, args[1], time.Now())
+		if err != nil {
+			log.Fatalf("can't create migration: %v", err)
+		}
+		fmt.Println("created " + path)
+		return
+	}
+
+	cfg, err := config.NewCalendar(configFile)
+	if err != nil {
+		log.Fatalf("can't get config: %v", err)
+	}
+	if cfg.Database.StorageDriver() != config.DriverPostgres {
+		log.Fatalf("migrations are supported by %s driver only", config.DriverPostgres)
+	}
+
+	ctx := context.Background()
+	db := cfg.Database
+	migrator, err := sqlstorage.OpenMigrator(ctx, sqlstorage.DSN(db.Username, db.Password, db.Address, db.DBName))
+	if err != nil {
+		log.Fatalf("can't start migrator: %v", err)
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatalf("migrate down failed: %v", err)
+		}
+		fmt.Printf("rolled back %d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status failed: %v", err)
+		}
+		printMigrationStatus(statuses)
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+func printMigrationStatus(statuses []sqlstorage.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Applied At\tMigration")
+	for _, s := range statuses {
+		appliedAt := "Pending"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%d_%s.sql\n", appliedAt, s.Version, s.Name)
+	}
+	w.Flush()
+}
@@ -4,16 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // При желании конфигурацию можно вынести в internal/config.
 // Организация конфига в main принуждает нас сужать API компонентов, использовать
 // при их конструировании только необходимые параметры, а также уменьшает вероятность циклической зависимости.
 type Calendar struct {
-	Logger     LoggerConf `json:"logger"`
-	RestServer RestConf   `json:"rest_server"`
-	GrpcServer GrpcConf   `json:"grpc_server"`
-	Database   DBConf     `json:"database"`
+	Logger     LoggerConf  `json:"logger"`
+	RestServer RestConf    `json:"rest_server"`
+	GrpcServer GrpcConf    `json:"grpc_server"`
+	Admin      AdminConf   `json:"admin"`
+	Database   DBConf      `json:"database"`
+	Webhooks   WebhookConf `json:"webhooks"`
+	Cache      CacheConf   `json:"cache"`
+	Tracing    TracingConf `json:"tracing"`
+	Auth       AuthConf    `json:"auth"`
 }
 
 func NewCalendar(filePath string) (Calendar, error) {
@@ -32,24 +38,166 @@ func NewCalendar(filePath string) (Calendar, error) {
 }
 
 type LoggerConf struct {
-	Level    int8   `json:"level"`
+	Level LogLevel `json:"level"`
+	// FilePath may be stdout or stderr too, empty path means stderr
 	FilePath string `json:"file_path"`
+	// Encoding is json for production or console
+	Encoding string `json:"encoding"`
+}
+
+// LogLevel is a zap level number or one of debug, info, warn, error.
+type LogLevel int8
+
+var logLevels = map[string]LogLevel{"debug": -1, "info": 0, "warn": 1, "error": 2}
+
+func (l *LogLevel) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var level int8
+		if err := json.Unmarshal(data, &level); err != nil {
+			return fmt.Errorf("invalid log level %s: %w", data, err)
+		}
+		*l = LogLevel(level)
+		return nil
+	}
+	level, ok := logLevels[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	*l = level
+	return nil
 }
 
 type RestConf struct {
-	Host string `json:"host"`
-	Port string `json:"port"`
+	Host      string        `json:"host"`
+	Port      string        `json:"port"`
+	AccessLog AccessLogConf `json:"access_log"`
+	Limits    LimitsConf    `json:"limits"`
+	TLS       TLSConf       `json:"tls"`
+}
+
+// AccessLogConf limits info lines of successful requests, zero values log all requests and disable slow ones.
+type AccessLogConf struct {
+	SampleEvery       int   `json:"sample_every"`
+	SlowThresholdInMs int64 `json:"slow_threshold_in_ms"`
 }
 
 type GrpcConf struct {
-	Host string `json:"host"`
-	Port string `json:"port"`
+	Host   string     `json:"host"`
+	Port   string     `json:"port"`
+	Limits LimitsConf `json:"limits"`
+	TLS    TLSConf    `json:"tls"`
 }
 
+// TLSConf enables tls when CertFile is set, files are read again on SIGHUP.
+type TLSConf struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile enables verification of client certificates signed by these CAs
+	ClientCAFile string `json:"client_ca_file"`
+	// RequireClientCert rejects clients without a certificate, otherwise it's verified only when sent
+	RequireClientCert bool `json:"require_client_cert"`
+}
+
+// LimitsConf protects a server from abusive clients, zero value disables a limit.
+type LimitsConf struct {
+	// RatePerSec and Burst are the token bucket of every client ip
+	RatePerSec         float64 `json:"rate_per_sec"`
+	Burst              int     `json:"burst"`
+	MaxBodyBytes       int64   `json:"max_body_bytes"`
+	RequestTimeoutInMs int64   `json:"request_timeout_in_ms"`
+}
+
+type WebhookConf struct {
+	Workers      int   `json:"workers"`
+	MaxAttempts  int   `json:"max_attempts"`
+	BackoffInMs  int64 `json:"backoff_in_ms"`
+	TimeoutInSec int64 `json:"timeout_in_sec"`
+	// AllowPrivateTargets lets webhooks reach loopback and private networks
+	AllowPrivateTargets bool `json:"allow_private_targets"`
+}
+
+// CacheConf enables caching of event range queries in front of the storage.
+// Over postgres the cache follows changes of other processes by notifications,
+// memory and bolt storages can't be shared, so the calendar is their only writer.
+type CacheConf struct {
+	Enabled  bool  `json:"enabled"`
+	Capacity int   `json:"capacity"`
+	TTLInSec int64 `json:"ttl_in_sec"`
+}
+
+// AuthConf makes rest and grpc servers accept only calls with a bearer jwt or an api key.
+type AuthConf struct {
+	Enabled bool `json:"enabled"`
+	// APIKeys maps a static key to the user id it authenticates
+	APIKeys map[string]string `json:"api_keys"`
+	JWT     JWTConf           `json:"jwt"`
+}
+
+type JWTConf struct {
+	// Algorithm is HS256 with Secret or RS256 with PublicKeyPath, empty disables jwt
+	Algorithm     string `json:"algorithm"`
+	Secret        string `json:"secret"`
+	PublicKeyPath string `json:"public_key_path"`
+	// Issuer and Audience are checked when they are set
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// UserClaim holds the user id, sub by default
+	UserClaim string `json:"user_claim"`
+}
+
+const (
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// TracingConf selects the span exporter, tracing is disabled without exporter.
+type TracingConf struct {
+	// Exporter is one of stdout or otlp
+	Exporter string `json:"exporter"`
+	// Endpoint is host:port of otlp grpc collector or the file of stdout exporter, empty means os.Stdout
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+	// SampleRatio is the share of traced root requests, zero traces all of them
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+const (
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverBolt     = "bolt"
+)
+
 type DBConf struct {
+	// Driver is one of memory, postgres or bolt, in_mem is kept for old configs without driver
+	Driver   string `json:"driver"`
 	InMem    bool   `json:"in_mem"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Address  string `json:"address"`
 	DBName   string `json:"db_name"`
+	// Path is the db file of bolt driver, the file is used by one process, so scheduler doesn't support bolt
+	Path string `json:"path"`
+	// RequireMigrated stops postgres driver from starting on a db with pending migrations
+	RequireMigrated bool `json:"require_migrated"`
+	// pool and timeout settings of postgres driver, zero keeps the default
+	MaxOpenConns         int   `json:"max_open_conns"`
+	MaxIdleConns         int   `json:"max_idle_conns"`
+	ConnMaxLifetimeInSec int64 `json:"conn_max_lifetime_in_sec"`
+	ConnMaxIdleTimeInSec int64 `json:"conn_max_idle_time_in_sec"`
+	QueryTimeoutInMs     int64 `json:"query_timeout_in_ms"`
+	// Replicas are addresses of postgres read replicas with the same credentials and db name
+	Replicas                  []string `json:"replicas"`
+	ReplicaCheckIntervalInSec int64    `json:"replica_check_interval_in_sec"`
+}
+
+func (c DBConf) StorageDriver() string {
+	switch {
+	case c.Driver != "":
+		return c.Driver
+	case c.InMem:
+		return DriverMemory
+	default:
+		return DriverPostgres
+	}
 }
@@ -7,10 +7,18 @@ import (
 )
 
 type Scheduler struct {
-	Logger        LoggerConf `json:"logger"`
-	RabbitMQ      Rabbit     `json:"rabbit_mq"`
-	Database      DBConf     `json:"database"`
-	IntervalInSec int64      `json:"interval_in_sec"`
+	Logger        LoggerConf  `json:"logger"`
+	RabbitMQ      Rabbit      `json:"rabbit_mq"`
+	Database      DBConf      `json:"database"`
+	IntervalInSec int64       `json:"interval_in_sec"`
+	Admin         AdminConf   `json:"admin"`
+	Tracing       TracingConf `json:"tracing"`
+}
+
+// AdminConf is the http listener with health probes, it is disabled without port.
+type AdminConf struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
 }
 
 func NewScheduler(filePath string) (Scheduler, error) {
@@ -25,5 +33,9 @@ func NewScheduler(filePath string) (Scheduler, error) {
 	if err != nil {
 		return Scheduler{}, fmt.Errorf("can't decode config: %w", err)
 	}
+	// bolt file is locked by the calendar process, a second process can't open it
+	if config.Database.StorageDriver() == DriverBolt {
+		return Scheduler{}, fmt.Errorf("storage driver %s is not supported by scheduler, use %s", DriverBolt, DriverPostgres)
+	}
 	return config, nil
 }
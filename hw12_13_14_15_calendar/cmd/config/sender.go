@@ -7,9 +7,11 @@ import (
 )
 
 type Sender struct {
-	Logger   LoggerConf `json:"logger"`
-	RabbitMQ Rabbit     `json:"rabbit_mq"`
-	Database DBConf     `json:"database"`
+	Logger   LoggerConf  `json:"logger"`
+	RabbitMQ Rabbit      `json:"rabbit_mq"`
+	Database DBConf      `json:"database"`
+	Admin    AdminConf   `json:"admin"`
+	Tracing  TracingConf `json:"tracing"`
 }
 
 type Rabbit struct {
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -11,9 +12,12 @@ import (
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/logger"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/mq/rabbit"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/admin"
 	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
 	sqlstorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 )
 
 var configFile string
@@ -30,10 +34,11 @@ func main() {
 		log.Fatalf("can't get config: %v", err)
 	}
 
-	logg, err := logger.New(cfg.Logger.Level, cfg.Logger.FilePath)
+	logg, err := logger.New(int8(cfg.Logger.Level), cfg.Logger.FilePath, cfg.Logger.Encoding)
 	if err != nil {
 		log.Fatalf("can't start logger %v\n", err)
 	}
+	defer logg.Sync() // nolint: errcheck
 
 	producer, err := rabbit.NewProducer(cfg.RabbitMQ)
 	if err != nil {
@@ -43,12 +48,16 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	scheduler := app.NewScheduler(
-		logg,
-		startStorageService(ctx, cfg.Database),
-		producer,
-		time.Duration(cfg.IntervalInSec)*time.Second,
-	)
+	tracer, err := tracing.Start(ctx, "scheduler", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("can't start tracing: %v", err)
+	}
+	defer shutdownTracing(tracer, logg)
+
+	storage := metrics.NewStorage(startStorageService(ctx, cfg.Database))
+	interval := time.Duration(cfg.IntervalInSec) * time.Second
+	scheduler := app.NewScheduler(logg, storage, producer, interval, metrics.Scheduler{})
+	adminServer := startAdminServer(ctx, cfg.Admin, logg, scheduler, producer, storage, interval)
 
 	go func() {
 		signals := make(chan os.Signal, 1)
@@ -61,21 +70,94 @@ func main() {
 			logg.Error("can't close connection", logg.String("msg", err.Error()))
 		}
 		cancel()
+
+		if adminServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			if err := adminServer.Stop(ctx); err != nil {
+				logg.Error("failed to stop admin server: " + err.Error())
+			}
+		}
 	}()
 
 	scheduler.Run(ctx)
 }
 
+func shutdownTracing(tracer *tracing.Provider, logg app.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logg.Error("failed to flush spans: " + err.Error())
+	}
+}
+
+// startAdminServer reports the scheduler not ready when it missed two ticks.
+func startAdminServer(
+	ctx context.Context,
+	cfg config.AdminConf,
+	logg app.Logger,
+	scheduler *app.Scheduler,
+	producer *rabbit.Producer,
+	storage app.Storage,
+	interval time.Duration,
+) *admin.Server {
+	if cfg.Port == "" {
+		return nil
+	}
+
+	started := time.Now()
+	s := admin.NewServer(
+		cfg.Host,
+		cfg.Port,
+		logg,
+		func() map[string]interface{} {
+			return map[string]interface{}{
+				"rabbit_connected": producer.Ping(ctx) == nil,
+				"last_tick":        scheduler.LastTick(),
+			}
+		},
+		admin.Probe{Name: "rabbit", Check: producer.Ping},
+		admin.Probe{Name: "storage", Check: func(ctx context.Context) error {
+			if p, ok := storage.(app.Pinger); ok {
+				return p.Ping(ctx)
+			}
+			return nil
+		}},
+		admin.Probe{Name: "tick", Check: func(ctx context.Context) error {
+			last := scheduler.LastTick()
+			if last.IsZero() {
+				last = started
+			}
+			if time.Since(last) > 2*interval {
+				return fmt.Errorf("last tick at %s", last.Format(time.RFC3339))
+			}
+			return nil
+		}},
+	)
+
+	go func() {
+		logg.Info("starting admin server at " + s.Address)
+		if err := s.Start(ctx); err != nil {
+			log.Fatalf("failed to start admin server: " + err.Error())
+		}
+	}()
+	return s
+}
+
 func startStorageService(ctx context.Context, cfg config.DBConf) app.Storage {
 	var s app.Storage
-	if cfg.InMem {
+	switch cfg.StorageDriver() {
+	case config.DriverMemory:
 		s = memorystorage.New()
-	} else {
-		sqlStore, err := sqlstorage.New(ctx, cfg.Username, cfg.Password, cfg.Address, cfg.DBName)
+	case config.DriverPostgres:
+		sqlStore, err := sqlstorage.New(ctx, cfg.Username, cfg.Password, cfg.Address, cfg.DBName, sqlstorage.ConfOptions(cfg)...)
 		if err != nil {
 			log.Fatalf("failed to start storage connection: " + err.Error())
 		}
+		metrics.RegisterRouting(sqlStore.RoutingStats)
 		s = sqlStore
+	default:
+		log.Fatalf("unknown storage driver: " + cfg.Driver)
 	}
 	return s
 }
@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/jackc/pgx/v4/stdlib" // nolint: gci
-
-	"github.com/jmoiron/sqlx"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/logger"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/mq/rabbit"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/admin"
+	sqlstorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 )
 
 var configFile string
@@ -30,10 +33,27 @@ func main() {
 		log.Fatalf("can't get config: %v", err)
 	}
 
-	logg, err := logger.New(cfg.Logger.Level, cfg.Logger.FilePath)
+	logg, err := logger.New(int8(cfg.Logger.Level), cfg.Logger.FilePath, cfg.Logger.Encoding)
 	if err != nil {
 		log.Fatalf("can't start logger %v\n", err)
 	}
+	defer logg.Sync() // nolint: errcheck
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer, err := tracing.Start(ctx, "sender", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("can't start tracing: %v", err)
+	}
+	defer shutdownTracing(tracer, logg)
+
+	db := cfg.Database
+	storage, err := sqlstorage.New(ctx, db.Username, db.Password, db.Address, db.DBName, sqlstorage.ConfOptions(db)...)
+	if err != nil {
+		log.Fatalf("failed to start storage connection: %v", err)
+	}
+	defer storage.Close()
 
 	rmq, err := rabbit.NewConsumer(cfg.RabbitMQ)
 	if err != nil {
@@ -50,12 +70,16 @@ func main() {
 		log.Fatalf("can't begin consume: %v", err)
 	}
 
+	var lastConsume int64
+	adminServer := startAdminServer(ctx, cfg.Admin, logg, rmq, storage, &lastConsume)
+
 	go func() {
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt)
 
 		<-signals
 		signal.Stop(signals)
+		cancel()
 
 		err := rmq.CloseChannel()
 		if err != nil {
@@ -66,19 +90,41 @@ func main() {
 		if err != nil {
 			logg.Error("can't close connection", logg.String("msg", err.Error()))
 		}
+
+		if adminServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			if err := adminServer.Stop(ctx); err != nil {
+				logg.Error("failed to stop admin server: " + err.Error())
+			}
+		}
 	}()
 
-	for msg := range rmq.Get() {
+	for msg := range rmq.Get(ctx) {
+		atomic.StoreInt64(&lastConsume, time.Now().UnixNano())
 		if msg.Err != nil {
 			log.Printf("got message with error: %s\n", msg.Err.Error())
 			continue
 		}
-		fakeSendNotification(logg, cfg.Database, msg.Notif)
+		fakeSendNotification(msg.Ctx, logg, storage, msg.Notif)
 	}
 }
 
-func fakeSendNotification(logg *logger.Logger, cfg config.DBConf, notif app.MQEventNotification) { // только для теста
-	logg.Info(
+func shutdownTracing(tracer *tracing.Provider, logg app.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logg.Error("failed to flush spans: " + err.Error())
+	}
+}
+
+func fakeSendNotification( // только для теста
+	ctx context.Context,
+	logg *logger.Logger,
+	storage *sqlstorage.EventDataStore,
+	notif app.MQEventNotification,
+) {
+	app.LoggerFromContext(ctx, logg).Info(
 		"got message",
 		logg.String("event_id", notif.EventID),
 		logg.String("title", notif.Title),
@@ -86,24 +132,51 @@ func fakeSendNotification(logg *logger.Logger, cfg config.DBConf, notif app.MQEv
 		logg.String("user_id", notif.UserID),
 	)
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", cfg.Username, cfg.Password, cfg.Address, cfg.DBName)
-	db, err := sqlx.Open("pgx", dsn)
+	// the message is already counted as acked by the consumer, the failure goes to storage metrics only
+	start := time.Now()
+	err := storage.AddNotification(ctx, notif)
+	metrics.ObserveStorage("AddNotification", err, time.Since(start))
 	if err != nil {
-		logg.Error("can't open sql", logg.String("msg", err.Error()))
+		app.LoggerFromContext(ctx, logg).Error("can't create notification in db", logg.String("msg", err.Error()))
 	}
+}
 
-	err = db.Ping()
-	if err != nil {
-		logg.Error("can't ping sql", logg.String("msg", err.Error()))
+// startAdminServer reports the time of the last consumed message, a quiet queue does not make sender not ready.
+func startAdminServer(
+	ctx context.Context,
+	cfg config.AdminConf,
+	logg app.Logger,
+	rmq *rabbit.Consumer,
+	storage *sqlstorage.EventDataStore,
+	lastConsume *int64,
+) *admin.Server {
+	if cfg.Port == "" {
+		return nil
 	}
 
-	_, err = db.Exec(`INSERT INTO notification (id, title, start_date) 
-			VALUES ($1, $2, $3)`,
-		notif.EventID,
-		notif.Title,
-		notif.Date,
+	s := admin.NewServer(
+		cfg.Host,
+		cfg.Port,
+		logg,
+		func() map[string]interface{} {
+			var last time.Time
+			if nano := atomic.LoadInt64(lastConsume); nano != 0 {
+				last = time.Unix(0, nano)
+			}
+			return map[string]interface{}{
+				"rabbit_connected": rmq.Ping(ctx) == nil,
+				"last_consume":     last,
+			}
+		},
+		admin.Probe{Name: "rabbit", Check: rmq.Ping},
+		admin.Probe{Name: "storage", Check: storage.Ping},
 	)
-	if err != nil {
-		logg.Error("can't create notification in db", logg.String("msg", err.Error()))
-	}
+
+	go func() {
+		logg.Info("starting admin server at " + s.Address)
+		if err := s.Start(ctx); err != nil {
+			log.Fatalf("failed to start admin server: " + err.Error())
+		}
+	}()
+	return s
 }
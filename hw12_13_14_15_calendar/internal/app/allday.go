@@ -0,0 +1,37 @@
+package app
+
+import "time"
+
+const DayLayout = "2006-01-02"
+
+var ErrInvalidAllDay = NewKindError(KindInvalid, "invalid_all_day", "all-day event must have start_day and end_day in YYYY-MM-DD format, end_day can't be before start_day")
+
+// prepareEvent validates the event and for all-day events derives StartDate and EndDate
+// from the days: midnight of start_day and midnight after end_day in the event zone.
+func prepareEvent(e *Event) error {
+	loc, err := LoadLocation(e.Timezone)
+	if err != nil {
+		return err
+	}
+
+	if !e.AllDay {
+		e.StartDay, e.EndDay = "", ""
+		return nil
+	}
+
+	if e.EndDay == "" {
+		e.EndDay = e.StartDay
+	}
+	start, err := time.ParseInLocation(DayLayout, e.StartDay, loc)
+	if err != nil {
+		return ErrInvalidAllDay
+	}
+	end, err := time.ParseInLocation(DayLayout, e.EndDay, loc)
+	if err != nil || end.Before(start) {
+		return ErrInvalidAllDay
+	}
+
+	e.StartDate = start.Unix()
+	e.EndDate = end.AddDate(0, 0, 1).Unix()
+	return nil
+}
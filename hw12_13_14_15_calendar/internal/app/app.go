@@ -14,7 +14,7 @@ type ProcessingError struct {
 
 func (e *ProcessingError) Error() string {
 	if e.Err != nil {
-		e.Message = e.Message + " --> " + e.Err.Error()
+		return e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
@@ -23,9 +23,12 @@ func (e *ProcessingError) Unwrap() error {
 }
 
 type Logger interface {
+	Debug(msg string, fields ...zap.Field)
 	Info(msg string, fields ...zap.Field)
 	Warn(msg string, fields ...zap.Field)
 	Error(msg string, fields ...zap.Field)
+	// With returns a child logger adding fields to every entry
+	With(fields ...zap.Field) Logger
 	String(key string, val string) zap.Field
 	Int64(key string, val int64) zap.Field
 	Duration(key string, val time.Duration) zap.Field
@@ -36,21 +39,67 @@ type Storage interface {
 	NewEvent(ctx context.Context, e Event) error
 	UpdateEvent(ctx context.Context, e Event) error
 	RemoveEvent(ctx context.Context, id string) error
+	Event(ctx context.Context, id string) (Event, error)
 	EventListFilterByStartDate(ctx context.Context, from int64, to int64) ([]Event, error)
+	EventListFilterByPeriod(ctx context.Context, from int64, to int64) ([]Event, error)
 	EventListFilterByReminderIn(ctx context.Context, from int64, to int64) ([]Event, error)
+	AddEventHistory(ctx context.Context, r EventHistoryRecord) error
+	EventHistory(ctx context.Context, eventID string) ([]EventHistoryRecord, error)
+	BulkApply(ctx context.Context, ops []BulkOperation, atomic bool) ([]BulkResult, error)
+	WebhookStorage
+	UserStorage
+}
+
+// Pinger is implemented by storages with a connection which may go down.
+type Pinger interface {
+	Ping(ctx context.Context) error
 }
 
 type App struct {
 	log     Logger
 	storage Storage
+	changes *ChangeBus
+
+	allowPrivateWebhooks bool
 }
 
 func New(logger Logger, storage Storage) *App {
-	return &App{log: logger, storage: storage}
+	return &App{
+		log:     logger,
+		storage: storage,
+		changes: NewChangeBus(defaultFeedBacklog, defaultFeedBufferSize),
+	}
+}
+
+// Ping reports the storage health, storages without Pinger are always healthy.
+func (a *App) Ping(ctx context.Context) error {
+	p, ok := a.storage.(Pinger)
+	if !ok {
+		return nil
+	}
+	return p.Ping(ctx)
+}
+
+// logger correlates entries with the request of ctx.
+func (a *App) logger(ctx context.Context) Logger {
+	return LoggerFromContext(ctx, a.log)
 }
 
 func (a *App) CreateEvent(ctx context.Context, e Event) error {
-	a.log.Info("create event")
+	a.logger(ctx).Info("create event")
+	if err := claimOwner(ctx, &e); err != nil {
+		return &ProcessingError{
+			Message: "can't create event",
+			Err:     err,
+		}
+	}
+	if err := prepareEvent(&e); err != nil {
+		return &ProcessingError{
+			Message: "can't create event",
+			Err:     err,
+		}
+	}
+
 	err := a.storage.NewEvent(ctx, e)
 	if err != nil {
 		return &ProcessingError{
@@ -58,38 +107,138 @@ func (a *App) CreateEvent(ctx context.Context, e Event) error {
 			Err:     err,
 		}
 	}
+	a.eventChanged(ctx, EventCreated, e.ID, nil, &e)
 	return nil
 }
 
 func (a *App) UpdateEvent(ctx context.Context, e Event) error {
-	err := a.storage.UpdateEvent(ctx, e)
+	if err := claimOwner(ctx, &e); err != nil {
+		return &ProcessingError{
+			Message: "can't update event",
+			Err:     err,
+		}
+	}
+	if err := prepareEvent(&e); err != nil {
+		return &ProcessingError{
+			Message: "can't update event",
+			Err:     err,
+		}
+	}
+
+	before, err := a.applyEvent(ctx, BulkUpdate, e)
 	if err != nil {
 		return &ProcessingError{
 			Message: "can't update event",
 			Err:     err,
 		}
 	}
+	a.eventChanged(ctx, EventUpdated, e.ID, before, &e)
 	return nil
 }
 
 func (a *App) RemoveEvent(ctx context.Context, id string) error {
-	err := a.storage.RemoveEvent(ctx, id)
+	before, err := a.applyEvent(ctx, BulkDelete, Event{ID: id})
 	if err != nil {
 		return &ProcessingError{
 			Message: "can't remove event",
 			Err:     err,
 		}
 	}
+	a.eventChanged(ctx, EventRemoved, id, before, nil)
 	return nil
 }
 
+// applyEvent changes a single event in one storage transaction, so the owner check and
+// the returned snapshot for history can't race with concurrent writers.
+func (a *App) applyEvent(ctx context.Context, typ BulkOperationType, e Event) (*Event, error) {
+	op := BulkOperation{Type: typ, Event: e, RequireOwner: UserFromContext(ctx)}
+	results, err := a.storage.BulkApply(ctx, []BulkOperation{op}, true)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Before, results[0].Err
+}
+
+func (a *App) Event(ctx context.Context, id string) (Event, error) {
+	e, err := a.storage.Event(ctx, id)
+	if err != nil {
+		return Event{}, &ProcessingError{
+			Message: "can't get event",
+			Err:     err,
+		}
+	}
+	if err := checkOwner(ctx, e); err != nil {
+		return Event{}, &ProcessingError{
+			Message: "can't get event",
+			Err:     err,
+		}
+	}
+	return e, nil
+}
+
 func (a *App) Events(ctx context.Context, from int64, to int64) ([]Event, error) {
-	events, err := a.storage.EventListFilterByStartDate(ctx, from, to)
+	events, err := a.storage.EventListFilterByPeriod(ctx, from, to)
 	if err != nil {
 		return nil, &ProcessingError{
 			Message: "can't get events",
 			Err:     err,
 		}
 	}
-	return events, nil
+	return ownEvents(ctx, events), nil
+}
+
+func (a *App) EventHistory(ctx context.Context, eventID string) ([]EventHistoryRecord, error) {
+	records, err := a.storage.EventHistory(ctx, eventID)
+	if err == nil {
+		err = checkHistoryOwner(ctx, records)
+	}
+	if err != nil {
+		return nil, &ProcessingError{
+			Message: "can't get event history",
+			Err:     err,
+		}
+	}
+	return records, nil
+}
+
+func (a *App) WatchEvents(ctx context.Context, filter ChangeFilter, afterSeq uint64) (<-chan EventChange, error) {
+	if err := claimFilter(ctx, &filter); err != nil {
+		return nil, &ProcessingError{
+			Message: "can't watch events",
+			Err:     err,
+		}
+	}
+
+	changes, err := a.changes.Subscribe(ctx, filter, afterSeq)
+	if err != nil {
+		return nil, &ProcessingError{
+			Message: "can't watch events",
+			Err:     err,
+		}
+	}
+	return changes, nil
+}
+
+func (a *App) eventChanged(ctx context.Context, action EventAction, eventID string, before, after *Event) {
+	if after != nil {
+		a.changes.Publish(action, *after, before)
+	} else {
+		a.changes.Publish(action, *before, nil)
+	}
+
+	record := EventHistoryRecord{
+		EventID: eventID,
+		Action:  action,
+		Actor:   ActorFromContext(ctx),
+		Date:    time.Now().Unix(),
+		Before:  before,
+		After:   after,
+	}
+	if err := a.storage.AddEventHistory(ctx, record); err != nil {
+		a.logger(ctx).Error(
+			"can't save event history",
+			a.log.String("id", eventID),
+			a.log.String("msg", err.Error()),
+		)
+	}
 }
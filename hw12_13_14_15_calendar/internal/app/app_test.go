@@ -8,6 +8,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 )
@@ -15,9 +16,16 @@ import (
 type mockLogger struct {
 }
 
+func (m *mockLogger) Debug(msg string, fields ...zap.Field) {
+}
+
 func (m *mockLogger) Info(msg string, fields ...zap.Field) {
 }
 
+func (m *mockLogger) With(fields ...zap.Field) app.Logger {
+	return m
+}
+
 func (m *mockLogger) Warn(msg string, fields ...zap.Field) {
 }
 
@@ -53,11 +61,23 @@ func (s *AppSuite) TearDownTest() {
 	s.mockCtl.Finish()
 }
 
+// expectApply expects a single event change in one storage transaction.
+func (s *AppSuite) expectApply(ctx context.Context, typ app.BulkOperationType, e app.Event, res app.BulkResult, err error) {
+	op := app.BulkOperation{Type: typ, Event: e}
+	res.EventID = e.ID
+	if err != nil {
+		s.mockStore.EXPECT().BulkApply(ctx, []app.BulkOperation{op}, true).Return(nil, err)
+		return
+	}
+	s.mockStore.EXPECT().BulkApply(ctx, []app.BulkOperation{op}, true).Return([]app.BulkResult{res}, nil)
+}
+
 func (s *AppSuite) TestCreateEventSuccess() {
 	event := app.Event{}
 	ctx := context.Background()
 
 	s.mockStore.EXPECT().NewEvent(ctx, event).Return(nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).Return(nil)
 	err := s.app.CreateEvent(ctx, event)
 
 	s.Require().NoError(err)
@@ -80,7 +100,8 @@ func (s *AppSuite) TestUpdateEventSuccess() {
 	event := app.Event{}
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().UpdateEvent(ctx, event).Return(nil)
+	s.expectApply(ctx, app.BulkUpdate, event, app.BulkResult{Before: &event}, nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).Return(nil)
 	err := s.app.UpdateEvent(ctx, event)
 
 	s.Require().NoError(err)
@@ -91,7 +112,7 @@ func (s *AppSuite) TestUpdateEventFail() {
 	ctx := context.Background()
 	sErr := errors.New("store_error")
 
-	s.mockStore.EXPECT().UpdateEvent(ctx, event).Return(sErr)
+	s.expectApply(ctx, app.BulkUpdate, event, app.BulkResult{}, sErr)
 	err := s.app.UpdateEvent(ctx, event)
 
 	s.Require().Error(err)
@@ -103,7 +124,8 @@ func (s *AppSuite) TestRemoveEventSuccess() {
 	eventID := "unique_event_id"
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().RemoveEvent(ctx, eventID).Return(nil)
+	s.expectApply(ctx, app.BulkDelete, app.Event{ID: eventID}, app.BulkResult{Before: &app.Event{ID: eventID}}, nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).Return(nil)
 	err := s.app.RemoveEvent(ctx, eventID)
 
 	s.Require().NoError(err)
@@ -114,7 +136,7 @@ func (s *AppSuite) TestRemoveEventFail() {
 	ctx := context.Background()
 	sErr := errors.New("store_error")
 
-	s.mockStore.EXPECT().RemoveEvent(ctx, eventID).Return(sErr)
+	s.expectApply(ctx, app.BulkDelete, app.Event{ID: eventID}, app.BulkResult{}, sErr)
 	err := s.app.RemoveEvent(ctx, eventID)
 
 	s.Require().Error(err)
@@ -129,7 +151,7 @@ func (s *AppSuite) TestEventsQuerySuccess() {
 
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().EventListFilterByStartDate(ctx, from, to).Return(events, nil)
+	s.mockStore.EXPECT().EventListFilterByPeriod(ctx, from, to).Return(events, nil)
 	evs, err := s.app.Events(ctx, from, to)
 
 	s.Require().NoError(err)
@@ -143,13 +165,167 @@ func (s *AppSuite) TestEventsQueryFail() {
 	sErr := errors.New("store_error")
 	ctx := context.Background()
 
-	s.mockStore.EXPECT().EventListFilterByStartDate(ctx, from, to).Return(nil, sErr)
+	s.mockStore.EXPECT().EventListFilterByPeriod(ctx, from, to).Return(nil, sErr)
 	evs, err := s.app.Events(ctx, from, to)
 
 	s.Require().Error(err)
 	s.Require().Nil(evs)
 }
 
+func (s *AppSuite) TestUpdateEventSavesHistory() {
+	before := mockEvents()[0]
+	after := before
+	after.Title = "Event_Title_Updated"
+	ctx := app.ContextWithActor(context.Background(), "unique_actor_uid")
+
+	s.expectApply(ctx, app.BulkUpdate, after, app.BulkResult{Before: &before}, nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r app.EventHistoryRecord) error {
+			s.Require().Equal(after.ID, r.EventID)
+			s.Require().Equal(app.EventUpdated, r.Action)
+			s.Require().Equal("unique_actor_uid", r.Actor)
+			s.Require().Equal(&before, r.Before)
+			s.Require().Equal(&after, r.After)
+			return nil
+		},
+	)
+	err := s.app.UpdateEvent(ctx, after)
+
+	s.Require().NoError(err)
+}
+
+func (s *AppSuite) TestRemoveEventNotExist() {
+	eventID := "unique_event_id"
+	ctx := context.Background()
+	sErr := errors.New("store_error")
+
+	s.expectApply(ctx, app.BulkDelete, app.Event{ID: eventID}, app.BulkResult{Err: sErr}, nil)
+	err := s.app.RemoveEvent(ctx, eventID)
+
+	s.Require().Error(err)
+	ok := errors.Is(err, sErr)
+	s.Require().True(ok)
+}
+
+func (s *AppSuite) TestEventOwnership() {
+	ctx := app.ContextWithUser(context.Background(), "user_1")
+
+	s.mockStore.EXPECT().NewEvent(ctx, app.Event{ID: "1", OwnerID: "user_1"}).Return(nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).Return(nil)
+	s.Require().NoError(s.app.CreateEvent(ctx, app.Event{ID: "1"}))
+
+	err := s.app.CreateEvent(ctx, app.Event{ID: "2", OwnerID: "user_2"})
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+
+	// the owner is checked by storage in the transaction of the change
+	s.mockStore.EXPECT().BulkApply(ctx, []app.BulkOperation{
+		{Type: app.BulkUpdate, Event: app.Event{ID: "3", OwnerID: "user_1"}, RequireOwner: "user_1"},
+	}, true).Return([]app.BulkResult{{EventID: "3", Err: app.ErrNotEventOwner}}, nil)
+	s.mockStore.EXPECT().BulkApply(ctx, []app.BulkOperation{
+		{Type: app.BulkDelete, Event: app.Event{ID: "3"}, RequireOwner: "user_1"},
+	}, true).Return([]app.BulkResult{{EventID: "3", Err: app.ErrNotEventOwner}}, nil)
+	err = s.app.UpdateEvent(ctx, app.Event{ID: "3"})
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+	err = s.app.RemoveEvent(ctx, "3")
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+	s.Require().Equal("user_1", app.ActorFromContext(ctx))
+}
+
+func (s *AppSuite) TestEventReadsOwnership() {
+	ctx := app.ContextWithUser(context.Background(), "user_1")
+	events := mockEvents()
+	events[1].OwnerID = "user_1"
+
+	s.mockStore.EXPECT().Event(ctx, events[0].ID).Return(events[0], nil)
+	_, err := s.app.Event(ctx, events[0].ID)
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+
+	s.mockStore.EXPECT().EventListFilterByPeriod(ctx, int64(0), int64(1)).Return(events, nil)
+	evs, err := s.app.Events(ctx, 0, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]app.Event{events[1]}, evs)
+
+	s.mockStore.EXPECT().EventHistory(ctx, events[0].ID).Return([]app.EventHistoryRecord{
+		{EventID: events[0].ID, Action: app.EventCreated, After: &events[0]},
+	}, nil)
+	_, err = s.app.EventHistory(ctx, events[0].ID)
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+
+	_, err = s.app.WatchEvents(ctx, app.ChangeFilter{OwnerID: events[0].OwnerID}, 0)
+	s.Require().True(errors.Is(err, app.ErrNotEventOwner))
+}
+
+func (s *AppSuite) TestEventHistorySuccess() {
+	eventID := "unique_event_id"
+	records := []app.EventHistoryRecord{{EventID: eventID, Action: app.EventCreated}}
+	ctx := context.Background()
+
+	s.mockStore.EXPECT().EventHistory(ctx, eventID).Return(records, nil)
+	res, err := s.app.EventHistory(ctx, eventID)
+
+	s.Require().NoError(err)
+	s.Require().Equal(records, res)
+}
+
+func (s *AppSuite) TestBulkApplySavesHistory() {
+	events := mockEvents()
+	ops := []app.BulkOperation{
+		{Type: app.BulkCreate, Event: events[0]},
+		{Type: app.BulkDelete, Event: events[1]},
+	}
+	sErr := errors.New("store_error")
+	results := []app.BulkResult{
+		{Index: 0, EventID: events[0].ID},
+		{Index: 1, EventID: events[1].ID, Err: sErr},
+	}
+	ctx := context.Background()
+
+	s.mockStore.EXPECT().BulkApply(ctx, ops, false).Return(results, nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r app.EventHistoryRecord) error {
+			s.Require().Equal(events[0].ID, r.EventID)
+			s.Require().Equal(app.EventCreated, r.Action)
+			return nil
+		},
+	)
+	res, err := s.app.BulkApply(ctx, ops, app.BulkBestEffort)
+
+	s.Require().NoError(err)
+	s.Require().Len(res, 2)
+	s.Require().Empty(res[0].Error)
+	s.Require().Equal(sErr.Error(), res[1].Error)
+}
+
+func (s *AppSuite) TestBulkApplyRequireOwner() {
+	ctx := app.ContextWithUser(context.Background(), "user_1")
+	ops := []app.BulkOperation{
+		{Type: app.BulkUpdate, Event: app.Event{ID: "3", OwnerID: "user_1"}},
+		{Type: app.BulkDelete, Event: app.Event{ID: "4"}},
+	}
+
+	// ownership is checked by storage in the transaction, without lookups per operation before it
+	s.mockStore.EXPECT().BulkApply(ctx, []app.BulkOperation{
+		{Type: app.BulkUpdate, Event: app.Event{ID: "3", OwnerID: "user_1"}, RequireOwner: "user_1"},
+		{Type: app.BulkDelete, Event: app.Event{ID: "4"}, RequireOwner: "user_1"},
+	}, true).Return([]app.BulkResult{
+		{Index: 0, EventID: "3", Err: app.ErrBulkAborted},
+		{Index: 1, EventID: "4", Err: app.ErrNotEventOwner},
+	}, nil)
+	res, err := s.app.BulkApply(ctx, ops, app.BulkAllOrNothing)
+
+	s.Require().NoError(err)
+	s.Require().Len(res, 2)
+	s.Require().Equal(app.ErrNotEventOwner.Error(), res[1].Error)
+}
+
+func (s *AppSuite) TestBulkApplyUnknownMode() {
+	res, err := s.app.BulkApply(context.Background(), nil, "partial")
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, app.ErrBulkUnknownMode))
+	s.Require().Nil(res)
+}
+
 func mockEvents() []app.Event {
 	return []app.Event{
 		{
@@ -173,6 +349,87 @@ func mockEvents() []app.Event {
 	}
 }
 
+func (s *AppSuite) TestCreateEventInvalidTimezone() {
+	event := app.Event{Timezone: "Mars/Olympus"}
+
+	err := s.app.CreateEvent(context.Background(), event)
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, app.ErrInvalidTimezone))
+}
+
+func (s *AppSuite) TestActorLocation() {
+	ctx := app.ContextWithActor(context.Background(), "unique_owner_uid")
+
+	s.mockStore.EXPECT().UserTimezone(ctx, "unique_owner_uid").Return("Asia/Tokyo", nil)
+	loc := s.app.ActorLocation(ctx)
+	s.Require().Equal("Asia/Tokyo", loc.String())
+
+	s.Require().Equal(time.UTC, s.app.ActorLocation(context.Background()))
+}
+
+func (s *AppSuite) TestSetUserTimezoneInvalid() {
+	err := s.app.SetUserTimezone(context.Background(), "unique_owner_uid", "Mars/Olympus")
+
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, app.ErrInvalidTimezone))
+}
+
+func (s *AppSuite) TestCreateAllDayEvent() {
+	event := app.Event{ID: "1", AllDay: true, StartDay: "2026-10-19", EndDay: "2026-10-20", Timezone: "Europe/Moscow"}
+	ctx := context.Background()
+
+	expected := event
+	expected.StartDate = time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC).Unix()
+	expected.EndDate = time.Date(2026, 10, 20, 21, 0, 0, 0, time.UTC).Unix()
+	s.mockStore.EXPECT().NewEvent(ctx, expected).Return(nil)
+	s.mockStore.EXPECT().AddEventHistory(ctx, gomock.Any()).Return(nil)
+	err := s.app.CreateEvent(ctx, event)
+
+	s.Require().NoError(err)
+}
+
+func (s *AppSuite) TestCreateAllDayEventInvalid() {
+	ctx := context.Background()
+
+	err := s.app.CreateEvent(ctx, app.Event{AllDay: true, StartDay: "19.10.2026"})
+	s.Require().True(errors.Is(err, app.ErrInvalidAllDay))
+
+	err = s.app.CreateEvent(ctx, app.Event{AllDay: true, StartDay: "2026-10-19", EndDay: "2026-10-18"})
+	s.Require().True(errors.Is(err, app.ErrInvalidAllDay))
+}
+
+type pingStorage struct {
+	*MockStorage
+	err error
+}
+
+func (p *pingStorage) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func (s *AppSuite) TestPing() {
+	ctx := context.Background()
+	s.Require().NoError(s.app.Ping(ctx))
+
+	pingErr := errors.New("connection refused")
+	a := app.New(&mockLogger{}, &pingStorage{MockStorage: s.mockStore, err: pingErr})
+	s.Require().Equal(pingErr, a.Ping(ctx))
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	app.MarkSessionWritten(ctx)
+	require.False(t, app.SessionWritten(ctx))
+
+	session := app.ContextWithSession(ctx)
+	require.False(t, app.SessionWritten(session))
+
+	app.MarkSessionWritten(context.WithValue(session, struct{}{}, "nested"))
+	require.True(t, app.SessionWritten(session))
+	require.False(t, app.SessionWritten(app.ContextWithSession(ctx)))
+}
+
 func TestAppSuite(t *testing.T) {
 	suite.Run(t, new(AppSuite))
 }
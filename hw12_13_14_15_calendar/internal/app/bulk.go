@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+)
+
+const MaxBulkOperations = 10000
+
+type BulkOperationType string
+
+const (
+	BulkCreate BulkOperationType = "create"
+	BulkUpdate BulkOperationType = "update"
+	BulkDelete BulkOperationType = "delete"
+)
+
+type BulkMode string
+
+const (
+	BulkAllOrNothing BulkMode = "all_or_nothing"
+	BulkBestEffort   BulkMode = "best_effort"
+)
+
+var (
+	ErrBulkAborted           = NewKindError(KindConflict, "bulk_aborted", "operation is not applied because the batch is aborted")
+	ErrBulkUnknownOperation  = NewKindError(KindInvalid, "unknown_bulk_operation", "unknown bulk operation type")
+	ErrBulkUnknownMode       = NewKindError(KindInvalid, "unknown_bulk_mode", "unknown bulk mode")
+	ErrBulkTooManyOperations = NewKindError(KindLimitExceeded, "too_many_bulk_operations", "too many operations in the batch")
+)
+
+type BulkOperation struct {
+	Type  BulkOperationType `json:"type"`
+	Event Event             `json:"event"`
+	// RequireOwner is checked by storage in the same transaction the event is changed
+	RequireOwner string `json:"-"`
+}
+
+// CheckOwner rejects update and delete of current event when it belongs to another user than required.
+func (op BulkOperation) CheckOwner(current Event) error {
+	if op.Type != BulkCreate && op.RequireOwner != "" && current.OwnerID != op.RequireOwner {
+		return ErrNotEventOwner
+	}
+	return nil
+}
+
+type BulkResult struct {
+	Index   int    `json:"index"`
+	EventID string `json:"event_id"`
+	Error   string `json:"error,omitempty"`
+	Err     error  `json:"-"`
+	Before  *Event `json:"-"`
+}
+
+func (a *App) BulkApply(ctx context.Context, ops []BulkOperation, mode BulkMode) ([]BulkResult, error) {
+	if mode == "" {
+		mode = BulkAllOrNothing
+	}
+	if mode != BulkAllOrNothing && mode != BulkBestEffort {
+		return nil, &ProcessingError{
+			Message: "can't apply operations",
+			Err:     ErrBulkUnknownMode,
+		}
+	}
+	if len(ops) > MaxBulkOperations {
+		return nil, &ProcessingError{
+			Message: "can't apply operations",
+			Err:     ErrBulkTooManyOperations,
+		}
+	}
+
+	for i := range ops {
+		ops[i].RequireOwner = UserFromContext(ctx)
+		if ops[i].Type == BulkDelete {
+			continue
+		}
+		err := claimOwner(ctx, &ops[i].Event)
+		if err == nil {
+			err = prepareEvent(&ops[i].Event)
+		}
+		if err != nil {
+			return nil, &ProcessingError{
+				Message: "can't apply operations",
+				Err:     err,
+			}
+		}
+	}
+
+	a.logger(ctx).Info("apply bulk operations", a.log.Int64("count", int64(len(ops))), a.log.String("mode", string(mode)))
+	results, err := a.storage.BulkApply(ctx, ops, mode == BulkAllOrNothing)
+	if err != nil {
+		return nil, &ProcessingError{
+			Message: "can't apply operations",
+			Err:     err,
+		}
+	}
+
+	for i, r := range results {
+		if r.Err != nil {
+			results[i].Error = r.Err.Error()
+			continue
+		}
+
+		op := ops[r.Index]
+		switch op.Type {
+		case BulkCreate:
+			a.eventChanged(ctx, EventCreated, op.Event.ID, nil, &op.Event)
+		case BulkUpdate:
+			a.eventChanged(ctx, EventUpdated, op.Event.ID, r.Before, &op.Event)
+		case BulkDelete:
+			a.eventChanged(ctx, EventRemoved, op.Event.ID, r.Before, nil)
+		}
+	}
+	return results, nil
+}
+
+// BulkAborted reports whether nothing of the batch of mode is applied, results explain which operation has failed.
+func BulkAborted(mode BulkMode, results []BulkResult) bool {
+	if mode == BulkBestEffort {
+		return false
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			return true
+		}
+	}
+	return false
+}
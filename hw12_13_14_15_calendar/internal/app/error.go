@@ -1,16 +1,84 @@
 package app
 
+import "errors"
+
+// Kind classifies domain errors, transports map it to their status codes in one place.
+type Kind string
+
+const (
+	KindUnknown       Kind = ""
+	KindNotFound      Kind = "not_found"
+	KindAlreadyExists Kind = "already_exists"
+	KindInvalid       Kind = "invalid"
+	KindConflict      Kind = "conflict"
+	KindForbidden     Kind = "forbidden"
+	KindUnavailable   Kind = "unavailable"
+	// KindExpired is for data which existed once but is no longer kept
+	KindExpired Kind = "expired"
+	// KindLimitExceeded is for requests too large to be processed
+	KindLimitExceeded Kind = "limit_exceeded"
+)
+
 type BaseError struct {
+	Kind Kind `json:"kind,omitempty"`
+	// Code is the machine readable reason for clients, it's more specific than the kind
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Err     error  `json:"err,omitempty"`
 }
 
+// NewKindError is used for sentinel errors clients can tell apart.
+func NewKindError(kind Kind, code, msg string) *BaseError {
+	return &BaseError{Kind: kind, Code: code, Message: msg}
+}
+
 func (e *BaseError) Error() string {
 	if e.Err != nil {
-		e.Message = e.Message + " --> " + e.Err.Error()
+		return e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
 func (e *BaseError) Unwrap() error {
 	return e.Err
 }
+
+func (e *BaseError) ErrorKind() Kind {
+	return e.Kind
+}
+
+func (e *BaseError) ErrorCode() string {
+	if e.Code == "" {
+		return string(e.Kind)
+	}
+	return e.Code
+}
+
+type kindError interface {
+	ErrorKind() Kind
+	ErrorCode() string
+}
+
+// KindOf returns the first kind found in the chain of err, errors of unknown kind are internal ones.
+func KindOf(err error) Kind {
+	if e := findKind(err); e != nil {
+		return e.ErrorKind()
+	}
+	return KindUnknown
+}
+
+// CodeOf returns the code of the error which defines the kind of err.
+func CodeOf(err error) string {
+	if e := findKind(err); e != nil {
+		return e.ErrorCode()
+	}
+	return ""
+}
+
+func findKind(err error) kindError {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(kindError); ok && e.ErrorKind() != KindUnknown { // nolint: errorlint
+			return e
+		}
+	}
+	return nil
+}
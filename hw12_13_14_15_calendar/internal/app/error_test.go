@@ -0,0 +1,35 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorMessageIsStable(t *testing.T) {
+	err := &app.BaseError{Message: "can't create", Err: errors.New("db is down")}
+	require.Equal(t, "can't create --> db is down", err.Error())
+	require.Equal(t, err.Error(), err.Error())
+
+	perr := &app.ProcessingError{Message: "can't process", Err: err}
+	require.Equal(t, "can't process --> can't create --> db is down", perr.Error())
+	require.Equal(t, perr.Error(), perr.Error())
+}
+
+func TestKindOf(t *testing.T) {
+	require.Equal(t, app.KindUnknown, app.KindOf(nil))
+	require.Equal(t, app.KindUnknown, app.KindOf(errors.New("db is down")))
+	require.Empty(t, app.CodeOf(errors.New("db is down")))
+
+	// the first known kind in the chain wins, wrappers without a kind are skipped
+	err := fmt.Errorf("can't update: %w", &app.BaseError{Message: "can't update", Err: app.ErrNotEventOwner})
+	require.Equal(t, app.KindForbidden, app.KindOf(err))
+	require.Equal(t, "not_event_owner", app.CodeOf(err))
+
+	// code defaults to the kind
+	err = &app.BaseError{Kind: app.KindUnavailable, Message: "db is down"}
+	require.Equal(t, "unavailable", app.CodeOf(err))
+}
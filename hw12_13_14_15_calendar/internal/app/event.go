@@ -8,4 +8,32 @@ type Event struct {
 	Description string `json:"description"`
 	OwnerID     string `json:"owner_id" db:"owner_id"`
 	RemindIn    int64  `json:"remind_in" db:"remind_in"`
+	Timezone    string `json:"timezone" db:"timezone"`
+	AllDay      bool   `json:"all_day" db:"all_day"`
+	StartDay    string `json:"start_day,omitempty" db:"start_day"`
+	EndDay      string `json:"end_day,omitempty" db:"end_day"`
+}
+
+// NewEventID is assigned to events created without an id.
+func NewEventID() string {
+	return randomID()
+}
+
+// Span returns the seconds covered by the event as closed interval [start, last], an instant event
+// covers its start second, otherwise it would never overlap anything. Unlike end, last never goes
+// past math.MaxInt64.
+func (e Event) Span() (int64, int64) {
+	if e.EndDate > e.StartDate {
+		return e.StartDate, e.EndDate - 1
+	}
+	return e.StartDate, e.StartDate
+}
+
+// Overlaps reports whether the event intersects the window [from, to] including both bounds:
+// start <= to AND end > from. The overlap query was asked with start < to, the upper bound is kept
+// inclusive like the one of EventListFilterByStartDate, so a window ending at the start of an event
+// still shows it to clients which used the start date filter before.
+func (e Event) Overlaps(from, to int64) bool {
+	start, last := e.Span()
+	return from <= to && start <= to && last >= from
 }
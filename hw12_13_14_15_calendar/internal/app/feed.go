@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+const (
+	defaultFeedBacklog    = 1024
+	defaultFeedBufferSize = 64
+)
+
+var ErrChangeFeedExpired = NewKindError(KindExpired, "change_feed_expired", "changes after this sequence are no longer available")
+
+type EventChange struct {
+	Seq    uint64      `json:"seq"`
+	Action EventAction `json:"action"`
+	Event  Event       `json:"event"`
+	Before *Event      `json:"before,omitempty"`
+}
+
+type ChangeFilter struct {
+	OwnerID string
+	From    int64
+	To      int64
+}
+
+func (f ChangeFilter) Match(c EventChange) bool {
+	if f.match(c.Event) {
+		return true
+	}
+	return c.Before != nil && f.match(*c.Before)
+}
+
+func (f ChangeFilter) match(e Event) bool {
+	if f.OwnerID != "" && e.OwnerID != f.OwnerID {
+		return false
+	}
+	from, to := f.From, f.To
+	if to == 0 {
+		to = math.MaxInt64
+	}
+	if from == 0 {
+		from = math.MinInt64
+	}
+	return e.Overlaps(from, to)
+}
+
+type subscriber struct {
+	filter ChangeFilter
+	ch     chan EventChange
+	// done is closed together with ch, so the goroutine waiting for the end of ctx exits on drop
+	done chan struct{}
+}
+
+type ChangeBus struct {
+	mu         sync.Mutex
+	seq        uint64
+	backlog    []EventChange
+	backlogCap int
+	bufferSize int
+	subs       map[*subscriber]struct{}
+}
+
+func NewChangeBus(backlogCap, bufferSize int) *ChangeBus {
+	return &ChangeBus{
+		backlogCap: backlogCap,
+		bufferSize: bufferSize,
+		subs:       make(map[*subscriber]struct{}),
+	}
+}
+
+func (b *ChangeBus) Publish(action EventAction, e Event, before *Event) EventChange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	change := EventChange{Seq: b.seq, Action: action, Event: e, Before: before}
+
+	b.backlog = append(b.backlog, change)
+	if len(b.backlog) > b.backlogCap {
+		b.backlog = b.backlog[len(b.backlog)-b.backlogCap:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(change) {
+			continue
+		}
+		select {
+		case sub.ch <- change:
+		default:
+			// slow subscriber is dropped, it can resume from the last received sequence
+			b.drop(sub)
+		}
+	}
+	return change
+}
+
+// Subscribe streams changes matching the filter until ctx is done.
+// Changes with a sequence greater than afterSeq are replayed from the backlog first,
+// afterSeq equal to zero means that only new changes are sent.
+func (b *ChangeBus) Subscribe(ctx context.Context, filter ChangeFilter, afterSeq uint64) (<-chan EventChange, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []EventChange
+	if afterSeq > 0 {
+		if afterSeq > b.seq || (len(b.backlog) > 0 && afterSeq+1 < b.backlog[0].Seq) {
+			return nil, ErrChangeFeedExpired
+		}
+		for _, c := range b.backlog {
+			if c.Seq > afterSeq && filter.Match(c) {
+				replay = append(replay, c)
+			}
+		}
+	}
+
+	sub := &subscriber{
+		filter: filter,
+		ch:     make(chan EventChange, b.bufferSize+len(replay)),
+		done:   make(chan struct{}),
+	}
+	for _, c := range replay {
+		sub.ch <- c
+	}
+	b.subs[sub] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.unsubscribe(sub)
+		case <-sub.done:
+		}
+	}()
+
+	return sub.ch, nil
+}
+
+func (b *ChangeBus) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		b.drop(sub)
+	}
+}
+
+// drop has to be called with the lock held.
+func (b *ChangeBus) drop(sub *subscriber) {
+	delete(b.subs, sub)
+	close(sub.ch)
+	close(sub.done)
+}
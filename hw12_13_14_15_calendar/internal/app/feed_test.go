@@ -0,0 +1,123 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeBusFilter(t *testing.T) {
+	bus := app.NewChangeBus(10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := bus.Subscribe(ctx, app.ChangeFilter{OwnerID: "owner_1", From: 100, To: 200}, 0)
+	require.NoError(t, err)
+
+	bus.Publish(app.EventCreated, app.Event{ID: "1", OwnerID: "owner_2", StartDate: 150}, nil)
+	bus.Publish(app.EventCreated, app.Event{ID: "2", OwnerID: "owner_1", StartDate: 300}, nil)
+	bus.Publish(app.EventCreated, app.Event{ID: "3", OwnerID: "owner_1", StartDate: 150}, nil)
+	bus.Publish(
+		app.EventUpdated,
+		app.Event{ID: "3", OwnerID: "owner_1", StartDate: 300},
+		&app.Event{ID: "3", OwnerID: "owner_1", StartDate: 150},
+	)
+
+	change := <-changes
+	require.Equal(t, uint64(3), change.Seq)
+	require.Equal(t, app.EventCreated, change.Action)
+	require.Equal(t, "3", change.Event.ID)
+
+	change = <-changes
+	require.Equal(t, uint64(4), change.Seq)
+	require.Equal(t, app.EventUpdated, change.Action)
+
+	cancel()
+	_, ok := <-changes
+	require.False(t, ok)
+}
+
+func TestChangeBusFilterMultiDay(t *testing.T) {
+	bus := app.NewChangeBus(10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := bus.Subscribe(ctx, app.ChangeFilter{From: 100, To: 200}, 0)
+	require.NoError(t, err)
+
+	bus.Publish(app.EventCreated, app.Event{ID: "1", StartDate: 10, EndDate: 100}, nil)
+	bus.Publish(app.EventCreated, app.Event{ID: "2", StartDate: 10, EndDate: 300}, nil)
+
+	change := <-changes
+	require.Equal(t, "2", change.Event.ID)
+}
+
+func TestChangeBusResume(t *testing.T) {
+	bus := app.NewChangeBus(3, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		bus.Publish(app.EventCreated, app.Event{ID: id}, nil)
+	}
+
+	changes, err := bus.Subscribe(ctx, app.ChangeFilter{}, 3)
+	require.NoError(t, err)
+
+	bus.Publish(app.EventRemoved, app.Event{ID: "1"}, nil)
+
+	for _, seq := range []uint64{4, 5, 6} {
+		change := <-changes
+		require.Equal(t, seq, change.Seq)
+	}
+
+	_, err = bus.Subscribe(ctx, app.ChangeFilter{}, 1)
+	require.True(t, errors.Is(err, app.ErrChangeFeedExpired))
+
+	_, err = bus.Subscribe(ctx, app.ChangeFilter{}, 100)
+	require.True(t, errors.Is(err, app.ErrChangeFeedExpired))
+}
+
+func TestChangeBusSlowSubscriber(t *testing.T) {
+	bus := app.NewChangeBus(10, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := bus.Subscribe(ctx, app.ChangeFilter{}, 0)
+	require.NoError(t, err)
+
+	bus.Publish(app.EventCreated, app.Event{ID: "1"}, nil)
+	bus.Publish(app.EventCreated, app.Event{ID: "2"}, nil)
+
+	change := <-changes
+	require.Equal(t, uint64(1), change.Seq)
+
+	_, ok := <-changes
+	require.False(t, ok)
+}
+
+func TestChangeBusDropReleasesSubscriber(t *testing.T) {
+	bus := app.NewChangeBus(10, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, err := bus.Subscribe(ctx, app.ChangeFilter{}, 0)
+		require.NoError(t, err)
+	}
+	require.GreaterOrEqual(t, runtime.NumGoroutine(), before+10)
+
+	// nobody reads, so every subscriber is dropped while ctx is still alive
+	bus.Publish(app.EventCreated, app.Event{ID: "1"}, nil)
+	bus.Publish(app.EventCreated, app.Event{ID: "2"}, nil)
+
+	require.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	}, time.Second, 10*time.Millisecond)
+}
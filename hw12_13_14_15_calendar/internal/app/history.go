@@ -0,0 +1,31 @@
+package app
+
+import "context"
+
+type EventAction string
+
+const (
+	EventCreated EventAction = "created"
+	EventUpdated EventAction = "updated"
+	EventRemoved EventAction = "removed"
+)
+
+type EventHistoryRecord struct {
+	EventID string      `json:"event_id"`
+	Action  EventAction `json:"action"`
+	Actor   string      `json:"actor"`
+	Date    int64       `json:"date"`
+	Before  *Event      `json:"before"`
+	After   *Event      `json:"after"`
+}
+
+type actorCtxKey struct{}
+
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorCtxKey{}).(string)
+	return actor
+}
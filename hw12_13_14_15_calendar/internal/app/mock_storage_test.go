@@ -34,6 +34,94 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// AddEventHistory mocks base method
+func (m *MockStorage) AddEventHistory(arg0 context.Context, arg1 app.EventHistoryRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddEventHistory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddEventHistory indicates an expected call of AddEventHistory
+func (mr *MockStorageMockRecorder) AddEventHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEventHistory", reflect.TypeOf((*MockStorage)(nil).AddEventHistory), arg0, arg1)
+}
+
+// AddWebhookDelivery mocks base method
+func (m *MockStorage) AddWebhookDelivery(arg0 context.Context, arg1 app.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhookDelivery", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddWebhookDelivery indicates an expected call of AddWebhookDelivery
+func (mr *MockStorageMockRecorder) AddWebhookDelivery(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhookDelivery", reflect.TypeOf((*MockStorage)(nil).AddWebhookDelivery), arg0, arg1)
+}
+
+// BulkApply mocks base method
+func (m *MockStorage) BulkApply(arg0 context.Context, arg1 []app.BulkOperation, arg2 bool) ([]app.BulkResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkApply", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]app.BulkResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkApply indicates an expected call of BulkApply
+func (mr *MockStorageMockRecorder) BulkApply(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkApply", reflect.TypeOf((*MockStorage)(nil).BulkApply), arg0, arg1, arg2)
+}
+
+// Event mocks base method
+func (m *MockStorage) Event(arg0 context.Context, arg1 string) (app.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Event", arg0, arg1)
+	ret0, _ := ret[0].(app.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Event indicates an expected call of Event
+func (mr *MockStorageMockRecorder) Event(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Event", reflect.TypeOf((*MockStorage)(nil).Event), arg0, arg1)
+}
+
+// EventHistory mocks base method
+func (m *MockStorage) EventHistory(arg0 context.Context, arg1 string) ([]app.EventHistoryRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventHistory", arg0, arg1)
+	ret0, _ := ret[0].([]app.EventHistoryRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EventHistory indicates an expected call of EventHistory
+func (mr *MockStorageMockRecorder) EventHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventHistory", reflect.TypeOf((*MockStorage)(nil).EventHistory), arg0, arg1)
+}
+
+// EventListFilterByPeriod mocks base method
+func (m *MockStorage) EventListFilterByPeriod(arg0 context.Context, arg1, arg2 int64) ([]app.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventListFilterByPeriod", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]app.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EventListFilterByPeriod indicates an expected call of EventListFilterByPeriod
+func (mr *MockStorageMockRecorder) EventListFilterByPeriod(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventListFilterByPeriod", reflect.TypeOf((*MockStorage)(nil).EventListFilterByPeriod), arg0, arg1, arg2)
+}
+
 // EventListFilterByReminderIn mocks base method
 func (m *MockStorage) EventListFilterByReminderIn(arg0 context.Context, arg1, arg2 int64) ([]app.Event, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +166,20 @@ func (mr *MockStorageMockRecorder) NewEvent(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewEvent", reflect.TypeOf((*MockStorage)(nil).NewEvent), arg0, arg1)
 }
 
+// NewWebhook mocks base method
+func (m *MockStorage) NewWebhook(arg0 context.Context, arg1 app.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewWebhook", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NewWebhook indicates an expected call of NewWebhook
+func (mr *MockStorageMockRecorder) NewWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewWebhook", reflect.TypeOf((*MockStorage)(nil).NewWebhook), arg0, arg1)
+}
+
 // RemoveEvent mocks base method
 func (m *MockStorage) RemoveEvent(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -92,6 +194,34 @@ func (mr *MockStorageMockRecorder) RemoveEvent(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveEvent", reflect.TypeOf((*MockStorage)(nil).RemoveEvent), arg0, arg1)
 }
 
+// RemoveWebhook mocks base method
+func (m *MockStorage) RemoveWebhook(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveWebhook", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveWebhook indicates an expected call of RemoveWebhook
+func (mr *MockStorageMockRecorder) RemoveWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveWebhook", reflect.TypeOf((*MockStorage)(nil).RemoveWebhook), arg0, arg1)
+}
+
+// SetUserTimezone mocks base method
+func (m *MockStorage) SetUserTimezone(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserTimezone", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserTimezone indicates an expected call of SetUserTimezone
+func (mr *MockStorageMockRecorder) SetUserTimezone(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserTimezone", reflect.TypeOf((*MockStorage)(nil).SetUserTimezone), arg0, arg1, arg2)
+}
+
 // UpdateEvent mocks base method
 func (m *MockStorage) UpdateEvent(arg0 context.Context, arg1 app.Event) error {
 	m.ctrl.T.Helper()
@@ -105,3 +235,48 @@ func (mr *MockStorageMockRecorder) UpdateEvent(arg0, arg1 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateEvent", reflect.TypeOf((*MockStorage)(nil).UpdateEvent), arg0, arg1)
 }
+
+// UserTimezone mocks base method
+func (m *MockStorage) UserTimezone(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserTimezone", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserTimezone indicates an expected call of UserTimezone
+func (mr *MockStorageMockRecorder) UserTimezone(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserTimezone", reflect.TypeOf((*MockStorage)(nil).UserTimezone), arg0, arg1)
+}
+
+// WebhookDeliveries mocks base method
+func (m *MockStorage) WebhookDeliveries(arg0 context.Context, arg1 string) ([]app.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WebhookDeliveries", arg0, arg1)
+	ret0, _ := ret[0].([]app.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WebhookDeliveries indicates an expected call of WebhookDeliveries
+func (mr *MockStorageMockRecorder) WebhookDeliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WebhookDeliveries", reflect.TypeOf((*MockStorage)(nil).WebhookDeliveries), arg0, arg1)
+}
+
+// Webhooks mocks base method
+func (m *MockStorage) Webhooks(arg0 context.Context) ([]app.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Webhooks", arg0)
+	ret0, _ := ret[0].([]app.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Webhooks indicates an expected call of Webhooks
+func (mr *MockStorageMockRecorder) Webhooks(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Webhooks", reflect.TypeOf((*MockStorage)(nil).Webhooks), arg0)
+}
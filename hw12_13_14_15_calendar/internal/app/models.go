@@ -1,5 +1,7 @@
 package app
 
+import "context"
+
 type MQEventNotification struct {
 	EventID string `json:"event_id"`
 	Title   string `json:"title"`
@@ -17,6 +19,8 @@ func NewMQEventNotification(event Event) MQEventNotification {
 }
 
 type MQMessage struct {
+	// Ctx carries the trace of the publisher, it's derived from the context of MQConsumer.Get
+	Ctx   context.Context
 	Notif MQEventNotification
 	Err   error
 }
@@ -7,7 +7,7 @@ import (
 type MQConsumer interface {
 	OpenChannel() error
 	BeginConsume() error
-	Get() <-chan MQMessage
+	Get(ctx context.Context) <-chan MQMessage
 	CloseChannel() error
 	CloseConn() error
 }
@@ -0,0 +1,81 @@
+package app
+
+import "context"
+
+var ErrNotEventOwner = NewKindError(KindForbidden, "not_event_owner", "event belongs to another user")
+
+type userCtxKey struct{}
+
+// ContextWithUser marks ctx as authenticated by userID, events of such requests are owned by the user.
+func ContextWithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ContextWithActor(ctx, userID), userCtxKey{}, userID)
+}
+
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userCtxKey{}).(string)
+	return userID
+}
+
+// claimOwner sets the authenticated user as owner of e, unauthenticated requests keep the owner as is.
+func claimOwner(ctx context.Context, e *Event) error {
+	userID := UserFromContext(ctx)
+	if userID == "" {
+		return nil
+	}
+	if e.OwnerID != "" && e.OwnerID != userID {
+		return ErrNotEventOwner
+	}
+	e.OwnerID = userID
+	return nil
+}
+
+func checkOwner(ctx context.Context, e Event) error {
+	if userID := UserFromContext(ctx); userID != "" && e.OwnerID != userID {
+		return ErrNotEventOwner
+	}
+	return nil
+}
+
+// ownEvents keeps the events of the authenticated user, unauthenticated requests see all of them.
+func ownEvents(ctx context.Context, events []Event) []Event {
+	userID := UserFromContext(ctx)
+	if userID == "" {
+		return events
+	}
+	owned := make([]Event, 0, len(events))
+	for _, e := range events {
+		if e.OwnerID == userID {
+			owned = append(owned, e)
+		}
+	}
+	return owned
+}
+
+// checkHistoryOwner checks the owner of the latest snapshot, so the history of an event
+// handed over to another user is visible only to the new owner.
+func checkHistoryOwner(ctx context.Context, records []EventHistoryRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	last := records[len(records)-1]
+	if last.After != nil {
+		return checkOwner(ctx, *last.After)
+	}
+	if last.Before != nil {
+		return checkOwner(ctx, *last.Before)
+	}
+	return nil
+}
+
+// claimFilter narrows filter to the events of the authenticated user.
+func claimFilter(ctx context.Context, filter *ChangeFilter) error {
+	userID := UserFromContext(ctx)
+	if userID == "" {
+		return nil
+	}
+	if filter.OwnerID != "" && filter.OwnerID != userID {
+		return ErrNotEventOwner
+	}
+	filter.OwnerID = userID
+	return nil
+}
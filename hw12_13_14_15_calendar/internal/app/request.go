@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxRequestIDLength bounds ids sent by clients, they go to every log line and response header.
+const maxRequestIDLength = 64
+
+type requestIDCtxKey struct{}
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// NewRequestID is used when the client did not send its own id.
+func NewRequestID() string {
+	return randomID()
+}
+
+// RequestIDOrNew keeps the id sent by a client when it has at most 64 characters of [A-Za-z0-9._-],
+// an empty or any other id is replaced by a new one.
+func RequestIDOrNew(id string) string {
+	if id == "" || len(id) > maxRequestIDLength {
+		return NewRequestID()
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return NewRequestID()
+		}
+	}
+	return id
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// LoggerFromContext adds request id and trace id of ctx to every entry of l, so lines of one request can be found.
+func LoggerFromContext(ctx context.Context, l Logger) Logger {
+	var fields []zap.Field
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, l.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		fields = append(fields, l.String("trace_id", sc.TraceID().String()))
+	}
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
@@ -3,18 +3,49 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+
+// SchedulerObserver gets the result of every notification tick, e.g. to export metrics.
+type SchedulerObserver interface {
+	TickDone(d time.Duration, published, failed int)
+}
+
 type Scheduler struct {
+	// lastTick is unix nano time of the last tick which reached the broker
+	lastTick int64
 	log      Logger
 	storage  Storage
 	producer MQProducer
 	interval time.Duration
+	observer SchedulerObserver
 }
 
-func NewScheduler(logger Logger, storage Storage, producer MQProducer, interval time.Duration) *Scheduler {
-	return &Scheduler{log: logger, storage: storage, producer: producer, interval: interval}
+// NewScheduler accepts nil observer.
+func NewScheduler(
+	logger Logger,
+	storage Storage,
+	producer MQProducer,
+	interval time.Duration,
+	observer SchedulerObserver,
+) *Scheduler {
+	return &Scheduler{log: logger, storage: storage, producer: producer, interval: interval, observer: observer}
+}
+
+func (s *Scheduler) LastTick() time.Time {
+	nano := atomic.LoadInt64(&s.lastTick)
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
 }
 
 func (s *Scheduler) Run(ctx context.Context) {
@@ -29,15 +60,29 @@ func (s *Scheduler) Run(ctx context.Context) {
 }
 
 func (s *Scheduler) publishNotificationMessage(ctx context.Context) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "scheduler.publishNotifications")
+	defer span.End()
+	// every tick is a request of its own, the id reaches sender in amqp headers
+	ctx = ContextWithRequestID(ctx, NewRequestID())
+	log := LoggerFromContext(ctx, s.log)
+
+	var published, failed int
+	if s.observer != nil {
+		defer func(start time.Time) {
+			s.observer.TickDone(time.Since(start), published, failed)
+		}(time.Now())
+	}
+
 	err := s.producer.OpenChannel()
 	if err != nil {
-		s.log.Error("can't open channel", s.log.String("msg", err.Error()))
+		log.Error("can't open channel", s.log.String("msg", err.Error()))
 		return
 	}
+	atomic.StoreInt64(&s.lastTick, time.Now().UnixNano())
 	defer func() {
 		err := s.producer.CloseChannel()
 		if err != nil {
-			s.log.Error("can't close channel", s.log.String("msg", err.Error()))
+			log.Error("can't close channel", s.log.String("msg", err.Error()))
 		}
 	}()
 
@@ -46,37 +91,63 @@ func (s *Scheduler) publishNotificationMessage(ctx context.Context) {
 
 	events, err := s.storage.EventListFilterByReminderIn(ctx, from.Unix(), to.Unix())
 	if err != nil {
-		s.log.Error("can't get events", s.log.String("msg", err.Error()))
+		log.Error("can't get events", s.log.String("msg", err.Error()))
 		return
 	}
 
+	log.Debug("publishing notifications", s.log.Int64("count", int64(len(events))))
 	for _, e := range events {
-		data, err := json.Marshal(NewMQEventNotification(e))
-		if err != nil {
-			s.log.Error("can't marshal event notification", s.log.String("msg", err.Error()))
+		if err := s.publishNotification(ctx, log, e); err != nil {
+			failed++
 			continue
 		}
-		err = s.producer.Publish(ctx, data)
-		if err != nil {
-			s.log.Error("can't publish event notification", s.log.String("msg", err.Error()))
-		}
+		published++
+	}
+}
+
+// publishNotification traces every notification on its own, the sender continues the trace from amqp headers.
+func (s *Scheduler) publishNotification(ctx context.Context, log Logger, e Event) error {
+	ctx, span := otel.Tracer(tracerName).Start(
+		ctx,
+		"scheduler.publishNotification",
+		trace.WithAttributes(attribute.String("event.id", e.ID)),
+	)
+	defer span.End()
+	log = log.With(s.log.String("event_id", e.ID))
+
+	data, err := json.Marshal(NewMQEventNotification(e))
+	if err != nil {
+		log.Error("can't marshal event notification", s.log.String("msg", err.Error()))
+		span.SetStatus(codes.Error, err.Error())
+		return err
 	}
+	err = s.producer.Publish(ctx, data)
+	if err != nil {
+		log.Error("can't publish event notification", s.log.String("msg", err.Error()))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	log.Debug("notification published")
+	return nil
 }
 
 func (s *Scheduler) clearEvents(ctx context.Context) {
+	ctx = ContextWithRequestID(ctx, NewRequestID())
+	log := LoggerFromContext(ctx, s.log)
+
 	from := time.Now().AddDate(-1, 0, 0)
 	to := from.Add(s.interval)
 
 	events, err := s.storage.EventListFilterByStartDate(ctx, from.Unix(), to.Unix())
 	if err != nil {
-		s.log.Error("can't get events", s.log.String("msg", err.Error()))
+		log.Error("can't get events", s.log.String("msg", err.Error()))
 		return
 	}
 
 	for _, e := range events {
 		err := s.storage.RemoveEvent(ctx, e.ID)
 		if err != nil {
-			s.log.Error(
+			log.Error(
 				"can't remove event",
 				s.log.String("id", e.ID),
 				s.log.String("msg", err.Error()),
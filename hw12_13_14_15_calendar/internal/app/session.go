@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// session is shared by all storage calls of one request, it remembers whether the request wrote anything.
+type session struct {
+	written int32
+}
+
+type sessionCtxKey struct{}
+
+// ContextWithSession starts a request session, storages with replicas read from the primary
+// after a write of the same session, so the request always sees its own changes.
+func ContextWithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, &session{})
+}
+
+// MarkSessionWritten does nothing for a context without session.
+func MarkSessionWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionCtxKey{}).(*session); ok {
+		atomic.StoreInt32(&s.written, 1)
+	}
+}
+
+func SessionWritten(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionCtxKey{}).(*session)
+	return ok && atomic.LoadInt32(&s.written) == 1
+}
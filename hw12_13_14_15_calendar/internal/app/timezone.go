@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+var ErrInvalidTimezone = NewKindError(KindInvalid, "invalid_timezone", "unknown timezone, IANA name is expected")
+
+type UserStorage interface {
+	SetUserTimezone(ctx context.Context, userID string, tz string) error
+	UserTimezone(ctx context.Context, userID string) (string, error)
+}
+
+// Location returns the zone of the event, UTC when the zone is not set.
+func (e Event) Location() *time.Location {
+	loc, err := LoadLocation(e.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (e Event) StartTime() time.Time {
+	return time.Unix(e.StartDate, 0).In(e.Location())
+}
+
+func (e Event) EndTime() time.Time {
+	return time.Unix(e.EndDate, 0).In(e.Location())
+}
+
+// LoadLocation is time.LoadLocation which treats an empty name as UTC instead of Local.
+func LoadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+func (a *App) SetUserTimezone(ctx context.Context, userID string, tz string) error {
+	if _, err := LoadLocation(tz); err != nil {
+		return &ProcessingError{
+			Message: "can't set user timezone",
+			Err:     err,
+		}
+	}
+
+	if err := a.storage.SetUserTimezone(ctx, userID, tz); err != nil {
+		return &ProcessingError{
+			Message: "can't set user timezone",
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+func (a *App) UserTimezone(ctx context.Context, userID string) (string, error) {
+	tz, err := a.storage.UserTimezone(ctx, userID)
+	if err != nil {
+		return "", &ProcessingError{
+			Message: "can't get user timezone",
+			Err:     err,
+		}
+	}
+	return tz, nil
+}
+
+// ActorLocation returns the zone saved for the actor of the request, UTC when nothing is saved.
+func (a *App) ActorLocation(ctx context.Context) *time.Location {
+	actor := ActorFromContext(ctx)
+	if actor == "" {
+		return time.UTC
+	}
+
+	tz, err := a.storage.UserTimezone(ctx, actor)
+	if err != nil {
+		a.logger(ctx).Warn("can't get user timezone", a.log.String("user_id", actor), a.log.String("msg", err.Error()))
+		return time.UTC
+	}
+
+	loc, err := LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,545 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Calendar-Signature"
+	WebhookActionHeader    = "X-Calendar-Event"
+	WebhookDeliveryHeader  = "X-Calendar-Delivery"
+
+	maxWebhookBackoff = 5 * time.Minute
+	// webhookQueueSize is the number of changes waiting for one webhook
+	webhookQueueSize = 256
+	minWatchBackoff  = 100 * time.Millisecond
+	maxWatchBackoff  = 30 * time.Second
+)
+
+var (
+	ErrInvalidWebhook = NewKindError(KindInvalid, "invalid_webhook", "webhook must have id, absolute http(s) url and known actions")
+	ErrWebhookTarget  = NewKindError(
+		KindInvalid,
+		"webhook_target_not_allowed",
+		"webhook url must not point to loopback, link-local or private address",
+	)
+	ErrNotWebhookOwner = NewKindError(KindForbidden, "not_webhook_owner", "webhook belongs to another user")
+)
+
+// privateNetworks are the ranges which webhooks can't reach, loopback and link-local ones are checked by net.IP.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+type WebhookStorage interface {
+	NewWebhook(ctx context.Context, w Webhook) error
+	RemoveWebhook(ctx context.Context, id string) error
+	Webhooks(ctx context.Context) ([]Webhook, error)
+	AddWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context, webhookID string) ([]WebhookDelivery, error)
+}
+
+// Webhook delivers changes of events owned by OwnerID or of all events when it's empty,
+// UserID is the user who created the webhook.
+type Webhook struct {
+	ID      string        `json:"id"`
+	URL     string        `json:"url"`
+	Secret  string        `json:"secret,omitempty"`
+	Actions []EventAction `json:"actions"`
+	OwnerID string        `json:"owner_id" db:"owner_id"`
+	UserID  string        `json:"user_id" db:"user_id"`
+}
+
+func (w Webhook) Match(c EventChange) bool {
+	if w.OwnerID != "" && c.Event.OwnerID != w.OwnerID {
+		return false
+	}
+	if len(w.Actions) == 0 {
+		return true
+	}
+	for _, a := range w.Actions {
+		if a == c.Action {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Webhook) validate(allowPrivate bool) error {
+	if w.ID == "" {
+		return ErrInvalidWebhook
+	}
+	for _, a := range w.Actions {
+		if a != EventCreated && a != EventUpdated && a != EventRemoved {
+			return ErrInvalidWebhook
+		}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidWebhook
+	}
+	if allowPrivate {
+		return nil
+	}
+	return checkWebhookHost(u.Hostname())
+}
+
+// checkWebhookHost rejects literal addresses and localhost names, names resolved to such addresses
+// are rejected by the client of NewWebhookClient when it dials them.
+func checkWebhookHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookTarget
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return checkWebhookIP(ip)
+	}
+	return nil
+}
+
+func checkWebhookIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return ErrWebhookTarget
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return ErrWebhookTarget
+		}
+	}
+	return nil
+}
+
+// NewWebhookClient checks every address it connects to, so a webhook url can't lead
+// into the internal network through dns. Proxies are not used, otherwise the proxy address would be checked.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{ // nolint: exhaustivestruct
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return ErrWebhookTarget
+			}
+			return checkWebhookIP(ip)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone() // nolint: forcetypeassert
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport} // nolint: exhaustivestruct
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+type WebhookDelivery struct {
+	WebhookID  string      `json:"webhook_id" db:"webhook_id"`
+	DeliveryID string      `json:"delivery_id" db:"delivery_id"`
+	EventID    string      `json:"event_id" db:"event_id"`
+	Action     EventAction `json:"action"`
+	Attempt    int         `json:"attempt"`
+	StatusCode int         `json:"status_code" db:"status_code"`
+	Error      string      `json:"error"`
+	Success    bool        `json:"success"`
+	Date       int64       `json:"date"`
+}
+
+type WebhookPayload struct {
+	DeliveryID string      `json:"delivery_id"`
+	Seq        uint64      `json:"seq"`
+	Action     EventAction `json:"action"`
+	Date       int64       `json:"date"`
+	Event      Event       `json:"event"`
+	Before     *Event      `json:"before,omitempty"`
+}
+
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// AllowPrivateWebhooks lets webhooks target loopback and private networks for setups where
+// receivers run next to the calendar, it has to be called before the app serves requests.
+func (a *App) AllowPrivateWebhooks() {
+	a.allowPrivateWebhooks = true
+}
+
+func (a *App) CreateWebhook(ctx context.Context, w Webhook) error {
+	w.UserID = UserFromContext(ctx)
+	if w.UserID != "" {
+		// authenticated users get changes of their own events only
+		if w.OwnerID != "" && w.OwnerID != w.UserID {
+			return &ProcessingError{
+				Message: "can't create webhook",
+				Err:     ErrNotEventOwner,
+			}
+		}
+		w.OwnerID = w.UserID
+	}
+	if err := w.validate(a.allowPrivateWebhooks); err != nil {
+		return &ProcessingError{
+			Message: "can't create webhook",
+			Err:     err,
+		}
+	}
+
+	if err := a.storage.NewWebhook(ctx, w); err != nil {
+		return &ProcessingError{
+			Message: "can't create webhook",
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+func (a *App) RemoveWebhook(ctx context.Context, id string) error {
+	if err := a.checkWebhookOwner(ctx, id); err != nil {
+		return &ProcessingError{
+			Message: "can't remove webhook",
+			Err:     err,
+		}
+	}
+	if err := a.storage.RemoveWebhook(ctx, id); err != nil {
+		return &ProcessingError{
+			Message: "can't remove webhook",
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+func (a *App) Webhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks, err := a.storage.Webhooks(ctx)
+	if err != nil {
+		return nil, &ProcessingError{
+			Message: "can't get webhooks",
+			Err:     err,
+		}
+	}
+
+	userID := UserFromContext(ctx)
+	owned := webhooks[:0]
+	for _, w := range webhooks {
+		if userID != "" && w.UserID != userID {
+			continue
+		}
+		w.Secret = ""
+		owned = append(owned, w)
+	}
+	return owned, nil
+}
+
+func (a *App) WebhookDeliveries(ctx context.Context, webhookID string) ([]WebhookDelivery, error) {
+	if err := a.checkWebhookOwner(ctx, webhookID); err != nil {
+		return nil, &ProcessingError{
+			Message: "can't get webhook deliveries",
+			Err:     err,
+		}
+	}
+	deliveries, err := a.storage.WebhookDeliveries(ctx, webhookID)
+	if err != nil {
+		return nil, &ProcessingError{
+			Message: "can't get webhook deliveries",
+			Err:     err,
+		}
+	}
+	return deliveries, nil
+}
+
+// checkWebhookOwner lets authenticated users touch only webhooks they created,
+// unknown ids are left to the storage to report.
+func (a *App) checkWebhookOwner(ctx context.Context, id string) error {
+	userID := UserFromContext(ctx)
+	if userID == "" {
+		return nil
+	}
+	webhooks, err := a.storage.Webhooks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, w := range webhooks {
+		if w.ID == id && w.UserID != userID {
+			return ErrNotWebhookOwner
+		}
+	}
+	return nil
+}
+
+type WebhookDispatcher struct {
+	log         Logger
+	application *App
+	storage     WebhookStorage
+	client      *http.Client
+	// slots bounds the number of requests sent at once over all webhooks
+	slots       chan struct{}
+	maxAttempts int
+	backoff     time.Duration
+
+	queues map[string]*webhookQueue
+	wg     sync.WaitGroup
+}
+
+// webhookQueue delivers changes to one webhook in order, so a receiver retried with backoff
+// holds back only its own changes and not the change feed.
+type webhookQueue struct {
+	jobs chan webhookJob
+}
+
+type webhookJob struct {
+	webhook Webhook
+	change  EventChange
+}
+
+// NewWebhookDispatcher delivers at most workers webhooks at once.
+func NewWebhookDispatcher(
+	logger Logger,
+	application *App,
+	storage WebhookStorage,
+	client *http.Client,
+	workers int,
+	maxAttempts int,
+	backoff time.Duration,
+) *WebhookDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &WebhookDispatcher{
+		log:         logger,
+		application: application,
+		storage:     storage,
+		client:      client,
+		slots:       make(chan struct{}, workers),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		queues:      make(map[string]*webhookQueue),
+	}
+}
+
+// Run subscribes to the change feed until ctx is done. Every subscription gets its own context,
+// so its feed goroutine ends before the next one starts.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	defer d.stopQueues()
+
+	var lastSeq uint64
+	backoff := minWatchBackoff
+	for ctx.Err() == nil {
+		subCtx, cancel := context.WithCancel(ctx)
+		changes, err := d.application.WatchEvents(subCtx, ChangeFilter{}, lastSeq)
+		if err != nil {
+			cancel()
+			if errors.Is(err, ErrChangeFeedExpired) {
+				d.log.Error(
+					"change feed no longer has changes after the last dispatched one, they are lost",
+					d.log.Int64("seq", int64(lastSeq)),
+				)
+				lastSeq = 0
+			} else {
+				d.log.Error("can't watch events", d.log.String("msg", err.Error()))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxWatchBackoff {
+				backoff = maxWatchBackoff
+			}
+			continue
+		}
+		backoff = minWatchBackoff
+
+		for change := range changes {
+			lastSeq = change.Seq
+			d.dispatch(ctx, change)
+		}
+		cancel()
+
+		if ctx.Err() == nil {
+			d.log.Warn("change feed dropped the dispatcher, resuming", d.log.Int64("seq", int64(lastSeq)))
+		}
+	}
+}
+
+// dispatch never waits for deliveries, a change is dropped with a log when the queue of its webhook is full.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, change EventChange) {
+	webhooks, err := d.storage.Webhooks(ctx)
+	if err != nil {
+		d.log.Error("can't get webhooks, change is lost", d.log.String("msg", err.Error()), d.log.Int64("seq", int64(change.Seq)))
+		return
+	}
+
+	for _, w := range webhooks {
+		if !w.Match(change) {
+			continue
+		}
+		select {
+		case d.queue(ctx, w.ID).jobs <- webhookJob{webhook: w, change: change}:
+		default:
+			d.log.Error(
+				"webhook queue is full, change is lost",
+				d.log.String("webhook_id", w.ID),
+				d.log.Int64("seq", int64(change.Seq)),
+			)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) queue(ctx context.Context, webhookID string) *webhookQueue {
+	if q, ok := d.queues[webhookID]; ok {
+		return q
+	}
+
+	q := &webhookQueue{jobs: make(chan webhookJob, webhookQueueSize)}
+	d.queues[webhookID] = q
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for job := range q.jobs {
+			if ctx.Err() != nil {
+				continue
+			}
+			d.deliver(ctx, job.webhook, job.change)
+		}
+	}()
+	return q
+}
+
+func (d *WebhookDispatcher) stopQueues() {
+	for id, q := range d.queues {
+		close(q.jobs)
+		delete(d.queues, id)
+	}
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, w Webhook, change EventChange) {
+	payload := WebhookPayload{
+		// seq starts over after restart, so it can't identify the delivery for receivers
+		DeliveryID: randomID(),
+		Seq:        change.Seq,
+		Action:     change.Action,
+		Date:       time.Now().Unix(),
+		Event:      change.Event,
+		Before:     change.Before,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.log.Error("can't marshal webhook payload", d.log.String("msg", err.Error()))
+		return
+	}
+
+	backoff := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		statusCode, err := d.sendWithSlot(ctx, w, payload, body)
+
+		delivery := WebhookDelivery{
+			WebhookID:  w.ID,
+			DeliveryID: payload.DeliveryID,
+			EventID:    change.Event.ID,
+			Action:     change.Action,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Success:    err == nil,
+			Date:       time.Now().Unix(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if sErr := d.storage.AddWebhookDelivery(ctx, delivery); sErr != nil {
+			d.log.Error("can't save webhook delivery", d.log.String("msg", sErr.Error()))
+		}
+
+		if err == nil {
+			return
+		}
+		d.log.Warn(
+			"webhook delivery failed",
+			d.log.String("webhook_id", w.ID),
+			d.log.String("delivery_id", payload.DeliveryID),
+			d.log.Int64("attempt", int64(attempt)),
+			d.log.String("msg", err.Error()),
+		)
+		if attempt == d.maxAttempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+}
+
+// sendWithSlot holds a slot only for the request, waiting between attempts doesn't block other webhooks.
+func (d *WebhookDispatcher) sendWithSlot(ctx context.Context, w Webhook, payload WebhookPayload, body []byte) (int, error) {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	defer func() { <-d.slots }()
+	return d.send(ctx, w, payload, body)
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, w Webhook, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookActionHeader, string(payload.Action))
+	req.Header.Set(WebhookDeliveryHeader, payload.DeliveryID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New("unexpected status code: " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
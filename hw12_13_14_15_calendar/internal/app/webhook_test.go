@@ -0,0 +1,246 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads []app.WebhookPayload
+	received chan struct{}
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Header.Get(app.WebhookSignatureHeader) != app.SignWebhookPayload("secret", body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var payload app.WebhookPayload
+	_ = json.Unmarshal(body, &payload)
+	wr.payloads = append(wr.payloads, payload)
+	wr.received <- struct{}{}
+}
+
+func TestWebhookDispatcherDelivery(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	store := memorystorage.New()
+	calendar := app.New(&mockLogger{}, store)
+	calendar.AllowPrivateWebhooks()
+	dispatcher := app.NewWebhookDispatcher(&mockLogger{}, calendar, store, server.Client(), 2, 5, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := calendar.CreateWebhook(ctx, app.Webhook{
+		ID:      "webhook_1",
+		URL:     server.URL,
+		Secret:  "secret",
+		Actions: []app.EventAction{app.EventUpdated},
+		OwnerID: "unique_owner_uid",
+	})
+	require.NoError(t, err)
+
+	go dispatcher.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	events := mockEvents()
+	for _, e := range events {
+		require.NoError(t, calendar.CreateEvent(ctx, e))
+	}
+	events[1].Title = "Event_Title_Updated"
+	require.NoError(t, calendar.UpdateEvent(ctx, events[1]))
+	require.NoError(t, calendar.CreateEvent(ctx, app.Event{ID: "other_owner_event", OwnerID: "other", StartDate: 1}))
+
+	select {
+	case <-receiver.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook is not delivered")
+	}
+
+	receiver.mu.Lock()
+	require.Len(t, receiver.payloads, 1)
+	require.Equal(t, app.EventUpdated, receiver.payloads[0].Action)
+	require.Equal(t, events[1], receiver.payloads[0].Event)
+	receiver.mu.Unlock()
+
+	var deliveries []app.WebhookDelivery
+	require.Eventually(t, func() bool {
+		deliveries, err = calendar.WebhookDeliveries(ctx, "webhook_1")
+		return err == nil && len(deliveries) == 3
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, deliveries[0].Success)
+	require.Equal(t, http.StatusInternalServerError, deliveries[0].StatusCode)
+	require.True(t, deliveries[2].Success)
+	require.Equal(t, 3, deliveries[2].Attempt)
+	// retries keep the id, so receivers can drop duplicates
+	require.Len(t, receiver.payloads[0].DeliveryID, 32)
+	for _, d := range deliveries {
+		require.Equal(t, receiver.payloads[0].DeliveryID, d.DeliveryID)
+	}
+}
+
+func TestWebhookDispatcherRetriesDontBlock(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	receiver := &webhookReceiver{received: make(chan struct{}, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	store := memorystorage.New()
+	calendar := app.New(&mockLogger{}, store)
+	calendar.AllowPrivateWebhooks()
+	// the failing webhook waits a minute before the next attempt, the other one must not wait for it
+	dispatcher := app.NewWebhookDispatcher(&mockLogger{}, calendar, store, server.Client(), 1, 5, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	actions := []app.EventAction{app.EventCreated}
+	require.NoError(t, calendar.CreateWebhook(ctx, app.Webhook{ID: "failing", URL: failing.URL, Secret: "secret", Actions: actions}))
+	require.NoError(t, calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: server.URL, Secret: "secret", Actions: actions}))
+
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	for _, e := range mockEvents() {
+		require.NoError(t, calendar.CreateEvent(ctx, e))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-receiver.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook is not delivered")
+		}
+	}
+
+	// retries waiting for the backoff end with the context
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher is not stopped")
+	}
+}
+
+func TestCreateWebhookInvalid(t *testing.T) {
+	calendar := app.New(&mockLogger{}, memorystorage.New())
+	ctx := context.Background()
+
+	err := calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: "ftp://example.com"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, app.ErrInvalidWebhook))
+
+	err = calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: "https://example.com", Actions: []app.EventAction{"moved"}})
+	require.True(t, errors.Is(err, app.ErrInvalidWebhook))
+}
+
+func TestCreateWebhookPrivateTarget(t *testing.T) {
+	calendar := app.New(&mockLogger{}, memorystorage.New())
+	ctx := context.Background()
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.10/hook",
+		"http://[fd00::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		err := calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: u})
+		require.True(t, errors.Is(err, app.ErrWebhookTarget), u)
+	}
+
+	require.NoError(t, calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: "https://example.com/hook"}))
+
+	calendar.AllowPrivateWebhooks()
+	require.NoError(t, calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_2", URL: "http://127.0.0.1:8080/hook"}))
+}
+
+func TestWebhookClientPrivateTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the name is resolved to loopback address only when dialing
+	u := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	_, err := app.NewWebhookClient(time.Second).Get(u) // nolint: noctx
+	require.True(t, errors.Is(err, app.ErrWebhookTarget))
+}
+
+func TestCreateWebhookUser(t *testing.T) {
+	calendar := app.New(&mockLogger{}, memorystorage.New())
+	ctx := app.ContextWithUser(context.Background(), "user_1")
+
+	require.NoError(t, calendar.CreateWebhook(ctx, app.Webhook{ID: "webhook_1", URL: "https://example.com/hook", UserID: "user_2"}))
+
+	webhooks, err := calendar.Webhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Equal(t, "user_1", webhooks[0].UserID)
+}
+
+func TestWebhooksOfOtherUsers(t *testing.T) {
+	calendar := app.New(&mockLogger{}, memorystorage.New())
+	ctx1 := app.ContextWithUser(context.Background(), "user_1")
+	ctx2 := app.ContextWithUser(context.Background(), "user_2")
+
+	require.NoError(t, calendar.CreateWebhook(ctx1, app.Webhook{ID: "webhook_1", URL: "https://example.com/hook"}))
+
+	// a webhook can't subscribe to events of another user
+	err := calendar.CreateWebhook(ctx2, app.Webhook{ID: "webhook_2", URL: "https://example.com/hook", OwnerID: "user_1"})
+	require.True(t, errors.Is(err, app.ErrNotEventOwner))
+	require.NoError(t, calendar.CreateWebhook(ctx2, app.Webhook{ID: "webhook_2", URL: "https://example.com/hook"}))
+
+	webhooks, err := calendar.Webhooks(ctx2)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Equal(t, "webhook_2", webhooks[0].ID)
+	require.Equal(t, "user_2", webhooks[0].OwnerID)
+
+	_, err = calendar.WebhookDeliveries(ctx2, "webhook_1")
+	require.True(t, errors.Is(err, app.ErrNotWebhookOwner))
+	err = calendar.RemoveWebhook(ctx2, "webhook_1")
+	require.True(t, errors.Is(err, app.ErrNotWebhookOwner))
+
+	webhooks, err = calendar.Webhooks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+
+	require.NoError(t, calendar.RemoveWebhook(ctx1, "webhook_1"))
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+
+	defaultUserClaim = "sub"
+	bearerPrefix     = "bearer "
+)
+
+type Error struct {
+	app.BaseError
+}
+
+func NewError(msg string, err error) *Error {
+	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var (
+	ErrNoCredentials    = NewError("bearer token or api key is required", nil)
+	ErrInvalidToken     = NewError("invalid bearer token", nil)
+	ErrInvalidAPIKey    = NewError("invalid api key", nil)
+	ErrUnknownAlgorithm = NewError("unknown jwt algorithm", nil)
+)
+
+// Authenticator resolves the user id of a call by a bearer jwt or a static api key.
+type Authenticator struct {
+	// apiKeys are sha256 of keys, so lookup time does not depend on the key prefix
+	apiKeys   map[[sha256.Size]byte]string
+	algorithm string
+	key       interface{}
+	issuer    string
+	audience  string
+	userClaim string
+}
+
+// New returns nil authenticator when auth is disabled.
+func New(cfg config.AuthConf) (*Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	a := &Authenticator{
+		apiKeys:   make(map[[sha256.Size]byte]string, len(cfg.APIKeys)),
+		algorithm: cfg.JWT.Algorithm,
+		issuer:    cfg.JWT.Issuer,
+		audience:  cfg.JWT.Audience,
+		userClaim: cfg.JWT.UserClaim,
+	}
+	if a.userClaim == "" {
+		a.userClaim = defaultUserClaim
+	}
+	for key, userID := range cfg.APIKeys {
+		a.apiKeys[sha256.Sum256([]byte(key))] = userID
+	}
+
+	switch cfg.JWT.Algorithm {
+	case "":
+	case AlgorithmHS256:
+		if cfg.JWT.Secret == "" {
+			return nil, NewError("HS256 requires a secret", nil)
+		}
+		a.key = []byte(cfg.JWT.Secret)
+	case AlgorithmRS256:
+		pem, err := os.ReadFile(cfg.JWT.PublicKeyPath)
+		if err != nil {
+			return nil, NewError("can't read jwt public key", err)
+		}
+		a.key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, NewError("can't parse jwt public key", err)
+		}
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+	return a, nil
+}
+
+// Authenticate returns the user id of authorization header value or api key, the header wins when both are sent.
+func (a *Authenticator) Authenticate(authorization, apiKey string) (string, error) {
+	if authorization != "" {
+		if len(authorization) < len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+			return "", ErrInvalidToken
+		}
+		return a.userFromToken(strings.TrimSpace(authorization[len(bearerPrefix):]))
+	}
+	if apiKey != "" {
+		userID, ok := a.apiKeys[sha256.Sum256([]byte(apiKey))]
+		if !ok {
+			return "", ErrInvalidAPIKey
+		}
+		return userID, nil
+	}
+	return "", ErrNoCredentials
+}
+
+func (a *Authenticator) userFromToken(token string) (string, error) {
+	if a.key == nil {
+		return "", ErrInvalidToken
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{a.algorithm}))
+	if _, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return a.key, nil
+	}); err != nil {
+		return "", invalidToken(err)
+	}
+	// jwt v4 checks exp only when it's present, tokens without it would never expire
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", invalidToken(errors.New("exp is missing"))
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return "", invalidToken(fmt.Errorf("issuer is not %s", a.issuer))
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return "", invalidToken(fmt.Errorf("audience is not %s", a.audience))
+	}
+
+	userID, _ := claims[a.userClaim].(string)
+	if userID == "" {
+		return "", invalidToken(fmt.Errorf("claim %s is empty", a.userClaim))
+	}
+	return userID, nil
+}
+
+// invalidToken keeps the reason for logs while callers match ErrInvalidToken.
+func invalidToken(reason error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidToken, reason)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestDisabled(t *testing.T) {
+	a, err := New(config.AuthConf{})
+	require.NoError(t, err)
+	require.Nil(t, a)
+}
+
+func TestHS256(t *testing.T) {
+	a, err := New(config.AuthConf{
+		Enabled: true,
+		JWT:     config.JWTConf{Algorithm: AlgorithmHS256, Secret: "secret", Issuer: "calendar", Audience: "api"},
+	})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{"sub": "user_1", "iss": "calendar", "aud": "api", "exp": time.Now().Add(time.Minute).Unix()}
+	userID, err := a.Authenticate(sign(t, jwt.SigningMethodHS256, []byte("secret"), claims), "")
+	require.NoError(t, err)
+	require.Equal(t, "user_1", userID)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "wrong secret", header: sign(t, jwt.SigningMethodHS256, []byte("other"), claims)},
+		{name: "expired", header: sign(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "user_1", "iss": "calendar", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()})},
+		{name: "no expiration", header: sign(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "user_1", "iss": "calendar", "aud": "api"})},
+		{name: "wrong issuer", header: sign(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "user_1", "iss": "other", "aud": "api", "exp": time.Now().Add(time.Minute).Unix()})},
+		{name: "wrong audience", header: sign(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "user_1", "iss": "calendar", "aud": "other", "exp": time.Now().Add(time.Minute).Unix()})},
+		{name: "no subject", header: sign(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"iss": "calendar", "aud": "api", "exp": time.Now().Add(time.Minute).Unix()})},
+		{name: "not bearer", header: "Basic dXNlcjpwYXNz"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := a.Authenticate(tc.header, "")
+			require.True(t, errors.Is(err, ErrInvalidToken))
+		})
+	}
+}
+
+func TestRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	a, err := New(config.AuthConf{Enabled: true, JWT: config.JWTConf{Algorithm: AlgorithmRS256, PublicKeyPath: path, UserClaim: "uid"}})
+	require.NoError(t, err)
+
+	userID, err := a.Authenticate(sign(t, jwt.SigningMethodRS256, key, jwt.MapClaims{"uid": "user_2", "exp": time.Now().Add(time.Minute).Unix()}), "")
+	require.NoError(t, err)
+	require.Equal(t, "user_2", userID)
+
+	// a token signed by the public key as HMAC secret must not pass
+	_, err = a.Authenticate(sign(t, jwt.SigningMethodHS256, der, jwt.MapClaims{"uid": "user_2", "exp": time.Now().Add(time.Minute).Unix()}), "")
+	require.Error(t, err)
+}
+
+func TestAPIKey(t *testing.T) {
+	a, err := New(config.AuthConf{Enabled: true, APIKeys: map[string]string{"key_1": "user_1"}})
+	require.NoError(t, err)
+
+	userID, err := a.Authenticate("", "key_1")
+	require.NoError(t, err)
+	require.Equal(t, "user_1", userID)
+
+	_, err = a.Authenticate("", "key_2")
+	require.True(t, errors.Is(err, ErrInvalidAPIKey))
+
+	_, err = a.Authenticate("", "")
+	require.True(t, errors.Is(err, ErrNoCredentials))
+
+	// jwt is not configured
+	_, err = a.Authenticate("Bearer token", "")
+	require.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	_, err := New(config.AuthConf{Enabled: true, JWT: config.JWTConf{Algorithm: "none"}})
+	require.True(t, errors.Is(err, ErrUnknownAlgorithm))
+}
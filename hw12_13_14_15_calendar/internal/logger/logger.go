@@ -4,21 +4,37 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+)
+
 type Logger struct {
 	logger *zap.Logger
 }
 
-func New(level int8, logFilePath string) (*Logger, error) {
+// New writes entries of level and above to logFilePath, empty path means stderr.
+// Json encoding uses the production config, console one is for development.
+func New(level int8, logFilePath string, encoding string) (*Logger, error) {
 	cfg := zap.NewDevelopmentConfig()
+	if encoding == EncodingJSON {
+		cfg = zap.NewProductionConfig()
+		// the level is set by config, sampling would drop lines of the same request
+		cfg.Sampling = nil
+	}
 	cfg.Level = zap.NewAtomicLevelAt(zapcore.Level(level))
 	cfg.DisableStacktrace = true
-	cfg.OutputPaths = []string{
-		logFilePath,
+	if logFilePath == "" {
+		logFilePath = "stderr"
 	}
+	cfg.OutputPaths = []string{logFilePath}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+
 	logger, err := cfg.Build()
 	if err != nil {
 		return nil, fmt.Errorf("can't build logger: %w", err)
@@ -26,6 +42,10 @@ func New(level int8, logFilePath string) (*Logger, error) {
 	return &Logger{logger: logger}, nil
 }
 
+func (l *Logger) Debug(msg string, fields ...zap.Field) {
+	l.logger.Debug(msg, fields...)
+}
+
 func (l *Logger) Info(msg string, fields ...zap.Field) {
 	l.logger.Info(msg, fields...)
 }
@@ -38,6 +58,15 @@ func (l *Logger) Warn(msg string, fields ...zap.Field) {
 	l.logger.Warn(msg, fields...)
 }
 
+func (l *Logger) With(fields ...zap.Field) app.Logger {
+	return &Logger{logger: l.logger.With(fields...)}
+}
+
+// Sync flushes buffered entries, it's called before exit.
+func (l *Logger) Sync() error {
+	return l.logger.Sync()
+}
+
 func (l *Logger) String(key string, val string) zap.Field {
 	return zap.Field{Key: key, Type: zapcore.StringType, String: val} // nolint: exhaustivestruct
 }
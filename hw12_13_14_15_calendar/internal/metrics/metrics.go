@@ -0,0 +1,142 @@
+// Package metrics keeps prometheus collectors of all calendar binaries, every binary exposes the default registry.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "calendar"
+
+var (
+	restRequests = promauto.NewHistogramVec(prometheus.HistogramOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "rest",
+		Name:      "request_duration_seconds",
+		Help:      "REST request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	grpcRequests = promauto.NewHistogramVec(prometheus.HistogramOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC call latency by method and code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	storageOperations = promauto.NewHistogramVec(prometheus.HistogramOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Storage operation latency by operation and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "result"})
+
+	schedulerTicks = promauto.NewHistogram(prometheus.HistogramOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "tick_duration_seconds",
+		Help:      "Duration of the scheduler notification tick.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	schedulerNotifications = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "notifications_total",
+		Help:      "Notifications published by the scheduler by result.",
+	}, []string{"result"})
+
+	senderMessages = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint: exhaustivestruct
+		Namespace: namespace,
+		Subsystem: "sender",
+		Name:      "messages_total",
+		Help:      "Messages of the sender by state: consumed, acked and failed.",
+	}, []string{"state"})
+)
+
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+
+	MessageConsumed = "consumed"
+	MessageAcked    = "acked"
+	MessageFailed   = "failed"
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveREST(route, method string, status int, d time.Duration) {
+	restRequests.WithLabelValues(route, method, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+func ObserveGRPC(method, code string, d time.Duration) {
+	grpcRequests.WithLabelValues(method, code).Observe(d.Seconds())
+}
+
+func ObserveStorage(operation string, err error, d time.Duration) {
+	storageOperations.WithLabelValues(operation, result(err)).Observe(d.Seconds())
+}
+
+func SenderMessage(state string) {
+	senderMessages.WithLabelValues(state).Inc()
+}
+
+// Scheduler is app.SchedulerObserver.
+type Scheduler struct{}
+
+func (Scheduler) TickDone(d time.Duration, published, failed int) {
+	schedulerTicks.Observe(d.Seconds())
+	schedulerNotifications.WithLabelValues(ResultOK).Add(float64(published))
+	schedulerNotifications.WithLabelValues(ResultError).Add(float64(failed))
+}
+
+// RegisterCache exposes hits and misses of the caching storage.
+func RegisterCache(stats func() storage.CacheStats) {
+	counterFuncs("cache", "requests_total", "Cached range queries by result.", "result", map[string]func() int64{
+		"hit":  func() int64 { return stats().Hits },
+		"miss": func() int64 { return stats().Misses },
+	})
+}
+
+// RegisterRouting exposes where the sql storage sent event list reads.
+func RegisterRouting(stats func() storage.RoutingStats) {
+	counterFuncs("storage", "reads_total", "Event list reads by routing decision.", "target", map[string]func() int64{
+		"replica":         func() int64 { return stats().ReplicaReads },
+		"primary":         func() int64 { return stats().PrimaryReads },
+		"read_your_write": func() int64 { return stats().ReadYourWrites },
+		"fallback":        func() int64 { return stats().Fallbacks },
+	})
+}
+
+// counterFuncs registers counters kept by other packages as one metric with label.
+func counterFuncs(subsystem, name, help, label string, values map[string]func() int64) {
+	for value, fn := range values {
+		fn := fn
+		prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{ // nolint: exhaustivestruct
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: prometheus.Labels{label: value},
+		}, func() float64 {
+			return float64(fn())
+		}))
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageResults(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage(memorystorage.New())
+
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "1", StartDate: 10, EndDate: 20}))
+	_, err := s.EventListFilterByPeriod(ctx, 100, 200)
+	require.True(t, errors.Is(err, storage.ErrNoEvents))
+
+	require.Equal(t, uint64(1), sampleCount(t, storageOperations.WithLabelValues("NewEvent", ResultOK)))
+	require.Equal(t, uint64(1), sampleCount(t, storageOperations.WithLabelValues("EventListFilterByPeriod", ResultOK)))
+	require.Equal(t, uint64(0), sampleCount(t, storageOperations.WithLabelValues("EventListFilterByPeriod", ResultError)))
+}
+
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestSchedulerAndSender(t *testing.T) {
+	Scheduler{}.TickDone(time.Second, 3, 1)
+	require.Equal(t, 3.0, testutil.ToFloat64(schedulerNotifications.WithLabelValues(ResultOK)))
+	require.Equal(t, 1.0, testutil.ToFloat64(schedulerNotifications.WithLabelValues(ResultError)))
+
+	SenderMessage(MessageConsumed)
+	SenderMessage(MessageAcked)
+	require.Equal(t, 1.0, testutil.ToFloat64(senderMessages.WithLabelValues(MessageAcked)))
+	require.Equal(t, 0.0, testutil.ToFloat64(senderMessages.WithLabelValues(MessageFailed)))
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Storage observes latency of every operation of the wrapped storage.
+type Storage struct {
+	storage app.Storage
+}
+
+func NewStorage(s app.Storage) *Storage {
+	return &Storage{storage: s}
+}
+
+func (s *Storage) NewEvent(ctx context.Context, e app.Event) (err error) {
+	defer observe("NewEvent", time.Now(), &err)
+	return s.storage.NewEvent(ctx, e)
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, e app.Event) (err error) {
+	defer observe("UpdateEvent", time.Now(), &err)
+	return s.storage.UpdateEvent(ctx, e)
+}
+
+func (s *Storage) RemoveEvent(ctx context.Context, id string) (err error) {
+	defer observe("RemoveEvent", time.Now(), &err)
+	return s.storage.RemoveEvent(ctx, id)
+}
+
+func (s *Storage) Event(ctx context.Context, id string) (_ app.Event, err error) {
+	defer observe("Event", time.Now(), &err)
+	return s.storage.Event(ctx, id)
+}
+
+func (s *Storage) EventListFilterByStartDate(ctx context.Context, from int64, to int64) (_ []app.Event, err error) {
+	defer observe("EventListFilterByStartDate", time.Now(), &err)
+	return s.storage.EventListFilterByStartDate(ctx, from, to)
+}
+
+func (s *Storage) EventListFilterByPeriod(ctx context.Context, from int64, to int64) (_ []app.Event, err error) {
+	defer observe("EventListFilterByPeriod", time.Now(), &err)
+	return s.storage.EventListFilterByPeriod(ctx, from, to)
+}
+
+func (s *Storage) EventListFilterByReminderIn(ctx context.Context, from int64, to int64) (_ []app.Event, err error) {
+	defer observe("EventListFilterByReminderIn", time.Now(), &err)
+	return s.storage.EventListFilterByReminderIn(ctx, from, to)
+}
+
+func (s *Storage) AddEventHistory(ctx context.Context, r app.EventHistoryRecord) (err error) {
+	defer observe("AddEventHistory", time.Now(), &err)
+	return s.storage.AddEventHistory(ctx, r)
+}
+
+func (s *Storage) EventHistory(ctx context.Context, eventID string) (_ []app.EventHistoryRecord, err error) {
+	defer observe("EventHistory", time.Now(), &err)
+	return s.storage.EventHistory(ctx, eventID)
+}
+
+func (s *Storage) BulkApply(ctx context.Context, ops []app.BulkOperation, atomic bool) (_ []app.BulkResult, err error) {
+	defer observe("BulkApply", time.Now(), &err)
+	return s.storage.BulkApply(ctx, ops, atomic)
+}
+
+func (s *Storage) NewWebhook(ctx context.Context, w app.Webhook) (err error) {
+	defer observe("NewWebhook", time.Now(), &err)
+	return s.storage.NewWebhook(ctx, w)
+}
+
+func (s *Storage) RemoveWebhook(ctx context.Context, id string) (err error) {
+	defer observe("RemoveWebhook", time.Now(), &err)
+	return s.storage.RemoveWebhook(ctx, id)
+}
+
+func (s *Storage) Webhooks(ctx context.Context) (_ []app.Webhook, err error) {
+	defer observe("Webhooks", time.Now(), &err)
+	return s.storage.Webhooks(ctx)
+}
+
+func (s *Storage) AddWebhookDelivery(ctx context.Context, d app.WebhookDelivery) (err error) {
+	defer observe("AddWebhookDelivery", time.Now(), &err)
+	return s.storage.AddWebhookDelivery(ctx, d)
+}
+
+func (s *Storage) WebhookDeliveries(ctx context.Context, webhookID string) (_ []app.WebhookDelivery, err error) {
+	defer observe("WebhookDeliveries", time.Now(), &err)
+	return s.storage.WebhookDeliveries(ctx, webhookID)
+}
+
+func (s *Storage) SetUserTimezone(ctx context.Context, userID string, tz string) (err error) {
+	defer observe("SetUserTimezone", time.Now(), &err)
+	return s.storage.SetUserTimezone(ctx, userID, tz)
+}
+
+func (s *Storage) UserTimezone(ctx context.Context, userID string) (_ string, err error) {
+	defer observe("UserTimezone", time.Now(), &err)
+	return s.storage.UserTimezone(ctx, userID)
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	if p, ok := s.storage.(app.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// observe counts domain errors like ErrNoEvents as ok, the storage answered them properly.
+func observe(operation string, start time.Time, err *error) {
+	var domainErr *storage.Error
+	if errors.As(*err, &domainErr) {
+		ObserveStorage(operation, nil, time.Since(start))
+		return
+	}
+	ObserveStorage(operation, *err, time.Since(start))
+}
@@ -1,12 +1,17 @@
 package rabbit
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 	"github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Consumer struct {
@@ -30,6 +35,14 @@ func (c *Consumer) CloseConn() error {
 	return c.conn.Close()
 }
 
+// Ping fails when amqp connection is closed by the broker or by CloseConn.
+func (c *Consumer) Ping(ctx context.Context) error {
+	if c.conn.IsClosed() {
+		return ErrConnectionClose
+	}
+	return nil
+}
+
 func (c *Consumer) OpenChannel() error {
 	var err error
 	c.channel, err = declareChannel(c.cfg, c.conn)
@@ -86,24 +99,49 @@ func (c *Consumer) BeginConsume() error {
 	return nil
 }
 
-func (c *Consumer) Get() <-chan app.MQMessage {
+// Get continues the trace of the publisher for every delivery, the channel is closed with the amqp channel.
+func (c *Consumer) Get(ctx context.Context) <-chan app.MQMessage {
 	mChan := make(chan app.MQMessage)
 
 	go func() {
+		defer close(mChan)
 		for d := range c.deliveries {
-			var notif app.MQEventNotification
-			err := json.Unmarshal(d.Body, &notif)
-			mess := app.MQMessage{
-				Notif: notif,
-				Err:   err,
-			}
-			if err == nil {
-				_ = d.Ack(false)
-			}
-
-			mChan <- mess
+			mChan <- c.receive(ctx, d)
 		}
 	}()
 
 	return mChan
 }
+
+func (c *Consumer) receive(ctx context.Context, d amqp.Delivery) app.MQMessage {
+	if id := headers(d.Headers).Get(requestIDHeader); id != "" {
+		ctx = app.ContextWithRequestID(ctx, app.RequestIDOrNew(id))
+	}
+	ctx, span := tracing.Tracer().Start(
+		tracing.Extract(ctx, headers(d.Headers)),
+		c.cfg.QueueName+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("rabbitmq"),
+			semconv.MessagingDestinationKey.String(d.Exchange),
+			semconv.MessagingRabbitmqRoutingKeyKey.String(d.RoutingKey),
+			semconv.MessagingOperationReceive,
+		),
+	)
+
+	var notif app.MQEventNotification
+	err := json.Unmarshal(d.Body, &notif)
+	metrics.SenderMessage(metrics.MessageConsumed)
+	failure := err
+	if err == nil {
+		failure = d.Ack(false)
+	}
+	if failure != nil {
+		metrics.SenderMessage(metrics.MessageFailed)
+	} else {
+		metrics.SenderMessage(metrics.MessageAcked)
+	}
+	tracing.End(span, failure)
+
+	return app.MQMessage{Ctx: ctx, Notif: notif, Err: err}
+}
@@ -8,7 +8,7 @@ type Error struct {
 
 func (e *Error) Error() string {
 	if e.Err != nil {
-		e.Message = "[rmq] " + e.Message + " --> " + e.Err.Error()
+		return "[rmq] " + e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
@@ -17,4 +17,7 @@ func NewError(msg string, err error) *Error {
 	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
 }
 
-var ErrChannelIsNil = NewError("channel is nil", nil)
+var (
+	ErrChannelIsNil    = &Error{BaseError: *app.NewKindError(app.KindUnavailable, "mq_unavailable", "channel is nil")}
+	ErrConnectionClose = &Error{BaseError: *app.NewKindError(app.KindUnavailable, "mq_unavailable", "connection is closed")}
+)
@@ -5,7 +5,11 @@ import (
 	"fmt"
 
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 	"github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Producer struct {
@@ -27,18 +31,44 @@ func (p *Producer) CloseConn() error {
 	return p.conn.Close()
 }
 
-func (p *Producer) Publish(ctx context.Context, body []byte) error {
+// Ping fails when amqp connection is closed by the broker or by CloseConn.
+func (p *Producer) Ping(ctx context.Context) error {
+	if p.conn.IsClosed() {
+		return ErrConnectionClose
+	}
+	return nil
+}
+
+func (p *Producer) Publish(ctx context.Context, body []byte) (err error) {
 	if p.channel == nil {
 		return ErrChannelIsNil
 	}
 
-	err := p.channel.Publish(
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		p.cfg.ExchangeName+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("rabbitmq"),
+			semconv.MessagingDestinationKey.String(p.cfg.ExchangeName),
+			semconv.MessagingRabbitmqRoutingKeyKey.String(p.cfg.RoutingKey),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	h := headers{}
+	tracing.Inject(ctx, h)
+	if id := app.RequestIDFromContext(ctx); id != "" {
+		h.Set(requestIDHeader, id)
+	}
+
+	err = p.channel.Publish(
 		p.cfg.ExchangeName,
 		p.cfg.RoutingKey,
 		false,
 		false,
 		amqp.Publishing{ // nolint: exhaustivestruct
-			Headers:         amqp.Table{},
+			Headers:         amqp.Table(h),
 			ContentType:     "application/json",
 			ContentEncoding: "utf8",
 			Body:            body,
@@ -25,3 +25,26 @@ func declareChannel(cfg config.Rabbit, conn *amqp.Connection) (*amqp.Channel, er
 
 	return channel, nil
 }
+
+// requestIDHeader passes the id of the scheduler tick to the sender logs.
+const requestIDHeader = "x-request-id"
+
+// headers carries the trace context in amqp message headers.
+type headers amqp.Table
+
+func (h headers) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h headers) Set(key string, value string) {
+	h[key] = value
+}
+
+func (h headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
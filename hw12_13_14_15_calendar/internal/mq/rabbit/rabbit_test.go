@@ -0,0 +1,31 @@
+package rabbit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeadersPropagateTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := tracing.New("scheduler", recorder, 0)
+	defer provider.Shutdown(context.Background()) // nolint: errcheck
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "publish")
+	defer span.End()
+
+	table := amqp.Table{}
+	tracing.Inject(ctx, headers(table))
+	require.Contains(t, table, "traceparent")
+	require.NoError(t, table.Validate())
+
+	extracted := trace.SpanContextFromContext(tracing.Extract(context.Background(), headers(table)))
+	require.True(t, extracted.IsRemote())
+	require.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+}
@@ -0,0 +1,124 @@
+// Package admin is a small http listener with health probes and metrics, it is kept off the public API.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
+)
+
+const probeTimeout = 2 * time.Second
+
+type ServerError struct {
+	app.BaseError
+}
+
+func NewError(msg string, err error) *ServerError {
+	return &ServerError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+// Probe is one readiness check, the binary is ready when every probe returns nil.
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Status is reported as is by /status, e.g. connection state and time of the last work done.
+type Status func() map[string]interface{}
+
+type Server struct {
+	Address string
+	server  *http.Server
+	probes  []Probe
+	status  Status
+	log     app.Logger
+}
+
+func NewServer(host, port string, logger app.Logger, status Status, probes ...Probe) *Server {
+	return &Server{
+		Address: net.JoinHostPort(host, port),
+		probes:  probes,
+		status:  status,
+		log:     logger,
+	}
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	s.server = &http.Server{ // nolint: exhaustivestruct
+		Addr:         s.Address,
+		Handler:      s.handler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return NewError("start server error", err)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return errors.New("admin server is nil")
+	}
+	if err := s.server.Shutdown(ctx); err != nil {
+		return NewError("stop server error", err)
+	}
+	return nil
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/status", s.statusHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	code := http.StatusOK
+	checks := make(map[string]string, len(s.probes))
+	for _, p := range s.probes {
+		checks[p.Name] = "ok"
+		if err := p.Check(ctx); err != nil {
+			checks[p.Name] = err.Error()
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	status := "ready"
+	if code != http.StatusOK {
+		status = "not ready"
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	var status map[string]interface{}
+	if s.status != nil {
+		status = s.status()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...zap.Field)            {}
+func (m *mockLogger) Info(msg string, fields ...zap.Field)             {}
+func (m *mockLogger) With(fields ...zap.Field) app.Logger              { return m }
+func (m *mockLogger) Warn(msg string, fields ...zap.Field)             {}
+func (m *mockLogger) Error(msg string, fields ...zap.Field)            {}
+func (m *mockLogger) String(key string, val string) zap.Field          { return zap.Field{} }
+func (m *mockLogger) Int64(key string, val int64) zap.Field            { return zap.Field{} }
+func (m *mockLogger) Duration(key string, val time.Duration) zap.Field { return zap.Field{} }
+
+func TestProbes(t *testing.T) {
+	var mqErr error
+	s := NewServer("", "", &mockLogger{},
+		func() map[string]interface{} { return map[string]interface{}{"rabbit_connected": mqErr == nil} },
+		Probe{Name: "rabbit", Check: func(ctx context.Context) error { return mqErr }},
+		Probe{Name: "storage", Check: func(ctx context.Context) error { return nil }},
+	)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	get := func(path string) (int, map[string]interface{}) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	code, _ := get("/healthz")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := get("/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{"rabbit": "ok", "storage": "ok"}, body["checks"])
+
+	mqErr = errors.New("connection is closed")
+	code, body = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, map[string]interface{}{"rabbit": "connection is closed", "storage": "ok"}, body["checks"])
+
+	code, body = get("/status")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{"rabbit_connected": false}, body)
+}
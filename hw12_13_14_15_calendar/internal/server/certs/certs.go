@@ -0,0 +1,115 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+)
+
+type Error struct {
+	app.BaseError
+}
+
+func NewError(msg string, err error) *Error {
+	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var (
+	ErrNoKeyFile  = NewError("tls key file is required with cert file", nil)
+	ErrNoClientCA = NewError("client ca file has no certificates", nil)
+	ErrNoCAFile   = NewError("client ca file is required to verify client certificates", nil)
+)
+
+// Reloader serves the certificate of config files, Reload swaps it for new handshakes
+// while established connections keep the old one.
+type Reloader struct {
+	cfg config.TLSConf
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// New returns nil when tls is disabled.
+func New(cfg config.TLSConf) (*Reloader, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+	if cfg.KeyFile == "" {
+		return nil, ErrNoKeyFile
+	}
+	if cfg.RequireClientCert && cfg.ClientCAFile == "" {
+		return nil, ErrNoCAFile
+	}
+
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again, the previous certificate is kept on error.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return NewError("can't load tls key pair", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return NewError("can't read client ca file", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return ErrNoClientCA
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs = &cert, clientCAs
+	r.mu.Unlock()
+	return nil
+}
+
+// Config returns the server config negotiating nextProtos, it picks the current files on every handshake.
+func (r *Reloader) Config(nextProtos ...string) *tls.Config {
+	return &tls.Config{ // nolint: exhaustivestruct
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		// http.Server.ServeTLS of older go versions needs GetCertificate to start without cert files
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.handshakeConfig(nextProtos), nil
+		},
+	}
+}
+
+func (r *Reloader) handshakeConfig(nextProtos []string) *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg := &tls.Config{ // nolint: exhaustivestruct
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   nextProtos,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg
+}
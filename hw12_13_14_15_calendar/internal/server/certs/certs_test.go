@@ -0,0 +1,184 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "calendar ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns pem encoded certificate and key signed by ca.
+func (ca testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "calendar"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// serve accepts connections of r until the test ends.
+func serve(t *testing.T, r *Reloader) string {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", r.Config())
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+				_, _ = conn.Read(make([]byte, 1))
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestReload(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.TLSConf{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	cert, key := ca.issue(t, 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+
+	r, err := New(cfg)
+	require.NoError(t, err)
+	addr := serve(t, r)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}) // nolint: exhaustivestruct
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	require.Equal(t, int64(10), serial())
+
+	cert, key = ca.issue(t, 11, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+	require.NoError(t, r.Reload())
+	require.Equal(t, int64(11), serial())
+
+	// broken files keep the served certificate
+	writeFile(t, cfg.KeyFile, []byte("broken"))
+	require.Error(t, r.Reload())
+	require.Equal(t, int64(11), serial())
+}
+
+func TestClientCert(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.TLSConf{
+		CertFile:          filepath.Join(dir, "cert.pem"),
+		KeyFile:           filepath.Join(dir, "key.pem"),
+		ClientCAFile:      filepath.Join(dir, "ca.pem"),
+		RequireClientCert: true,
+	}
+	cert, key := ca.issue(t, 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, cert)
+	writeFile(t, cfg.KeyFile, key)
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+
+	r, err := New(cfg)
+	require.NoError(t, err)
+	addr := serve(t, r)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	handshake := func(certs ...tls.Certificate) error {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, Certificates: certs, MinVersion: tls.VersionTLS12}) // nolint: exhaustivestruct
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// tls 1.3 client learns about the rejected certificate on the first read,
+		// an accepted one just has nothing to read
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+		_, err = conn.Read(make([]byte, 1))
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		return err
+	}
+
+	clientCert, clientKey := ca.issue(t, 20, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+
+	require.Error(t, handshake())
+	require.NoError(t, handshake(pair))
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(config.TLSConf{})
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	_, err = New(config.TLSConf{CertFile: "cert.pem"})
+	require.True(t, errors.Is(err, ErrNoKeyFile))
+
+	_, err = New(config.TLSConf{CertFile: "cert.pem", KeyFile: "key.pem", RequireClientCert: true})
+	require.True(t, errors.Is(err, ErrNoCAFile))
+}
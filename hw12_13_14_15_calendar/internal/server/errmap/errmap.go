@@ -0,0 +1,63 @@
+// Package errmap is the single place where kinds of domain errors become transport codes.
+package errmap
+
+import (
+	"net/http"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is set to the error info of grpc statuses.
+const Domain = "calendar"
+
+type mapping struct {
+	http int
+	grpc codes.Code
+}
+
+var kinds = map[app.Kind]mapping{
+	app.KindNotFound:      {http.StatusNotFound, codes.NotFound},
+	app.KindAlreadyExists: {http.StatusConflict, codes.AlreadyExists},
+	app.KindInvalid:       {http.StatusBadRequest, codes.InvalidArgument},
+	app.KindConflict:      {http.StatusConflict, codes.Aborted},
+	app.KindForbidden:     {http.StatusForbidden, codes.PermissionDenied},
+	app.KindUnavailable:   {http.StatusServiceUnavailable, codes.Unavailable},
+	app.KindExpired:       {http.StatusGone, codes.OutOfRange},
+	app.KindLimitExceeded: {http.StatusRequestEntityTooLarge, codes.ResourceExhausted},
+}
+
+// HTTPStatus returns http.StatusInternalServerError for errors of unknown kind.
+func HTTPStatus(err error) int {
+	if m, ok := kinds[app.KindOf(err)]; ok {
+		return m.http
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns codes.Internal for errors of unknown kind.
+func GRPCCode(err error) codes.Code {
+	if m, ok := kinds[app.KindOf(err)]; ok {
+		return m.grpc
+	}
+	return codes.Internal
+}
+
+// GRPCStatus converts err to a status error, the code of a domain error is passed as the reason of ErrorInfo details.
+func GRPCStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st := status.New(GRPCCode(err), err.Error())
+	code := app.CodeOf(err)
+	if code == "" {
+		return st.Err()
+	}
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: Domain}) // nolint: exhaustivestruct
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
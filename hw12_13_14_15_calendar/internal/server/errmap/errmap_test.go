@@ -0,0 +1,50 @@
+package errmap
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{storage.ErrEventDoesNotExist, http.StatusNotFound},
+		{storage.ErrEventAlreadyExist, http.StatusConflict},
+		{app.ErrInvalidTimezone, http.StatusBadRequest},
+		{app.ErrNotEventOwner, http.StatusForbidden},
+		{app.ErrChangeFeedExpired, http.StatusGone},
+		{app.ErrBulkTooManyOperations, http.StatusRequestEntityTooLarge},
+		{&app.BaseError{Message: "can't create event", Err: storage.ErrEventAlreadyExist}, http.StatusConflict},
+		{errors.New("db is down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.status, HTTPStatus(tt.err), tt.err.Error())
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	require.NoError(t, GRPCStatus(nil))
+
+	st := status.Convert(GRPCStatus(&app.BaseError{Message: "can't remove event", Err: storage.ErrEventDoesNotExist}))
+	require.Equal(t, codes.NotFound, st.Code())
+	require.Equal(t, "can't remove event --> event does not exist", st.Message())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, "event_not_found", info.Reason)
+	require.Equal(t, Domain, info.Domain)
+
+	st = status.Convert(GRPCStatus(errors.New("db is down")))
+	require.Equal(t, codes.Internal, st.Code())
+	require.Empty(t, st.Details())
+}
@@ -21,6 +21,9 @@ type EventServiceClient interface {
 	UpdateEvent(ctx context.Context, in *Event, opts ...grpc.CallOption) (*UpdateEventResponse, error)
 	RemoveEvent(ctx context.Context, in *EventID, opts ...grpc.CallOption) (*RemoveEventResponse, error)
 	Events(ctx context.Context, in *EventsQuery, opts ...grpc.CallOption) (*EventsValues, error)
+	EventHistory(ctx context.Context, in *EventID, opts ...grpc.CallOption) (*EventHistoryValues, error)
+	WatchEvents(ctx context.Context, in *EventsQuery, opts ...grpc.CallOption) (EventService_WatchEventsClient, error)
+	BulkEvents(ctx context.Context, opts ...grpc.CallOption) (EventService_BulkEventsClient, error)
 }
 
 type eventServiceClient struct {
@@ -67,6 +70,81 @@ func (c *eventServiceClient) Events(ctx context.Context, in *EventsQuery, opts .
 	return out, nil
 }
 
+func (c *eventServiceClient) EventHistory(ctx context.Context, in *EventID, opts ...grpc.CallOption) (*EventHistoryValues, error) {
+	out := new(EventHistoryValues)
+	err := c.cc.Invoke(ctx, "/pb.EventService/EventHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventServiceClient) WatchEvents(ctx context.Context, in *EventsQuery, opts ...grpc.CallOption) (EventService_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_EventService_serviceDesc.Streams[0], "/pb.EventService/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventServiceWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EventService_WatchEventsClient interface {
+	Recv() (*EventChange, error)
+	grpc.ClientStream
+}
+
+type eventServiceWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventServiceWatchEventsClient) Recv() (*EventChange, error) {
+	m := new(EventChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *eventServiceClient) BulkEvents(ctx context.Context, opts ...grpc.CallOption) (EventService_BulkEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_EventService_serviceDesc.Streams[1], "/pb.EventService/BulkEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventServiceBulkEventsClient{stream}
+	return x, nil
+}
+
+type EventService_BulkEventsClient interface {
+	Send(*BulkOperation) error
+	CloseAndRecv() (*BulkResults, error)
+	grpc.ClientStream
+}
+
+type eventServiceBulkEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventServiceBulkEventsClient) Send(m *BulkOperation) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *eventServiceBulkEventsClient) CloseAndRecv() (*BulkResults, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BulkResults)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EventServiceServer is the server API for EventService service.
 // All implementations must embed UnimplementedEventServiceServer
 // for forward compatibility
@@ -75,6 +153,9 @@ type EventServiceServer interface {
 	UpdateEvent(context.Context, *Event) (*UpdateEventResponse, error)
 	RemoveEvent(context.Context, *EventID) (*RemoveEventResponse, error)
 	Events(context.Context, *EventsQuery) (*EventsValues, error)
+	EventHistory(context.Context, *EventID) (*EventHistoryValues, error)
+	WatchEvents(*EventsQuery, EventService_WatchEventsServer) error
+	BulkEvents(EventService_BulkEventsServer) error
 	mustEmbedUnimplementedEventServiceServer()
 }
 
@@ -94,6 +175,15 @@ func (UnimplementedEventServiceServer) RemoveEvent(context.Context, *EventID) (*
 func (UnimplementedEventServiceServer) Events(context.Context, *EventsQuery) (*EventsValues, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Events not implemented")
 }
+func (UnimplementedEventServiceServer) EventHistory(context.Context, *EventID) (*EventHistoryValues, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EventHistory not implemented")
+}
+func (UnimplementedEventServiceServer) WatchEvents(*EventsQuery, EventService_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedEventServiceServer) BulkEvents(EventService_BulkEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method BulkEvents not implemented")
+}
 func (UnimplementedEventServiceServer) mustEmbedUnimplementedEventServiceServer() {}
 
 // UnsafeEventServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -179,6 +269,71 @@ func _EventService_Events_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EventService_EventHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EventID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventServiceServer).EventHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.EventService/EventHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventServiceServer).EventHistory(ctx, req.(*EventID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventService_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsQuery)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventServiceServer).WatchEvents(m, &eventServiceWatchEventsServer{stream})
+}
+
+type EventService_WatchEventsServer interface {
+	Send(*EventChange) error
+	grpc.ServerStream
+}
+
+type eventServiceWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventServiceWatchEventsServer) Send(m *EventChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _EventService_BulkEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventServiceServer).BulkEvents(&eventServiceBulkEventsServer{stream})
+}
+
+type EventService_BulkEventsServer interface {
+	SendAndClose(*BulkResults) error
+	Recv() (*BulkOperation, error)
+	grpc.ServerStream
+}
+
+type eventServiceBulkEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventServiceBulkEventsServer) SendAndClose(m *BulkResults) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *eventServiceBulkEventsServer) Recv() (*BulkOperation, error) {
+	m := new(BulkOperation)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _EventService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.EventService",
 	HandlerType: (*EventServiceServer)(nil),
@@ -199,7 +354,22 @@ var _EventService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Events",
 			Handler:    _EventService_Events_Handler,
 		},
+		{
+			MethodName: "EventHistory",
+			Handler:    _EventService_EventHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _EventService_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "BulkEvents",
+			Handler:       _EventService_BulkEvents_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/EventService.proto",
 }
@@ -3,11 +3,15 @@ package grpcsrv
 import (
 	"context"
 	"errors"
+	"io"
 
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/errmap"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type API struct { // nolint: maligned
@@ -20,31 +24,22 @@ func NewAPI(application *app.App) *API {
 }
 
 func (a *API) CreateEvent(ctx context.Context, event *Event) (*CreateEventResponse, error) {
-	err := a.application.CreateEvent(ctx, toAppEvent(event))
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := a.application.CreateEvent(ctx, toAppEvent(event)); err != nil {
+		return nil, errmap.GRPCStatus(err)
 	}
 	return &CreateEventResponse{}, nil
 }
 
 func (a *API) UpdateEvent(ctx context.Context, event *Event) (*UpdateEventResponse, error) {
-	err := a.application.UpdateEvent(ctx, toAppEvent(event))
-	if err != nil {
-		if errors.Is(err, storage.ErrEventDoesNotExist) {
-			return nil, status.Error(codes.NotFound, err.Error())
-		}
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := a.application.UpdateEvent(ctx, toAppEvent(event)); err != nil {
+		return nil, errmap.GRPCStatus(err)
 	}
 	return &UpdateEventResponse{}, nil
 }
 
 func (a *API) RemoveEvent(ctx context.Context, eventID *EventID) (*RemoveEventResponse, error) {
-	err := a.application.RemoveEvent(ctx, eventID.Id)
-	if err != nil {
-		if errors.Is(err, storage.ErrEventDoesNotExist) {
-			return nil, status.Error(codes.NotFound, err.Error())
-		}
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := a.application.RemoveEvent(ctx, eventID.Id); err != nil {
+		return nil, errmap.GRPCStatus(err)
 	}
 	return &RemoveEventResponse{}, nil
 }
@@ -52,10 +47,7 @@ func (a *API) RemoveEvent(ctx context.Context, eventID *EventID) (*RemoveEventRe
 func (a *API) Events(ctx context.Context, query *EventsQuery) (*EventsValues, error) {
 	events, err := a.application.Events(ctx, query.From, query.To)
 	if err != nil {
-		if errors.Is(err, storage.ErrNoEvents) {
-			return nil, status.Error(codes.NotFound, err.Error())
-		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, errmap.GRPCStatus(err)
 	}
 
 	pbEvents := make([]*Event, len(events))
@@ -66,16 +58,113 @@ func (a *API) Events(ctx context.Context, query *EventsQuery) (*EventsValues, er
 	return &EventsValues{Events: pbEvents}, nil
 }
 
+func (a *API) EventHistory(ctx context.Context, eventID *EventID) (*EventHistoryValues, error) {
+	records, err := a.application.EventHistory(ctx, eventID.Id)
+	if err != nil {
+		return nil, errmap.GRPCStatus(err)
+	}
+
+	if len(records) == 0 {
+		return nil, errmap.GRPCStatus(storage.ErrEventDoesNotExist)
+	}
+
+	pbRecords := make([]*EventHistoryRecord, len(records))
+	for i, r := range records {
+		pbRecords[i] = toPBEventHistoryRecord(r)
+	}
+
+	return &EventHistoryValues{Records: pbRecords}, nil
+}
+
+func (a *API) WatchEvents(query *EventsQuery, stream EventService_WatchEventsServer) error {
+	filter := app.ChangeFilter{OwnerID: query.OwnerId, From: query.From, To: query.To}
+	changes, err := a.application.WatchEvents(stream.Context(), filter, query.AfterSeq)
+	if err != nil {
+		return errmap.GRPCStatus(err)
+	}
+
+	// header tells the client that the subscription is established
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for change := range changes {
+		if err := stream.Send(toPBEventChange(change)); err != nil {
+			return err
+		}
+	}
+
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unavailable, "change feed subscription is closed")
+}
+
+func (a *API) BulkEvents(stream EventService_BulkEventsServer) error {
+	var (
+		ops  []app.BulkOperation
+		mode app.BulkMode
+	)
+	for {
+		op, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(ops) == 0 {
+			mode = app.BulkMode(op.Mode)
+		}
+		if len(ops) == app.MaxBulkOperations {
+			return errmap.GRPCStatus(app.ErrBulkTooManyOperations)
+		}
+		ops = append(ops, app.BulkOperation{Type: app.BulkOperationType(op.Type), Event: toAppEvent(op.Event)})
+	}
+
+	results, err := a.application.BulkApply(stream.Context(), ops, mode)
+	if err != nil {
+		return errmap.GRPCStatus(err)
+	}
+
+	pbResults := make([]*BulkResult, len(results))
+	for i, r := range results {
+		pbResults[i] = &BulkResult{Index: int32(r.Index), EventId: r.EventID, Error: r.Error}
+	}
+
+	// rolled back batch fails like in rest, per operation results are passed in the status details
+	if app.BulkAborted(mode, results) {
+		st, err := status.Convert(errmap.GRPCStatus(app.ErrBulkAborted)).WithDetails(&BulkResults{Results: pbResults})
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return st.Err()
+	}
+	return stream.SendAndClose(&BulkResults{Results: pbResults})
+}
+
 func toAppEvent(event *Event) app.Event {
-	return app.Event{
-		ID:          event.Id,
-		Title:       event.Title,
-		StartDate:   event.StartDate,
-		EndDate:     event.EndDate,
-		Description: event.Description,
-		OwnerID:     event.OwnerId,
-		RemindIn:    event.RemindIn,
+	e := app.Event{
+		ID:          event.GetId(),
+		Title:       event.GetTitle(),
+		StartDate:   event.GetStartDate(),
+		EndDate:     event.GetEndDate(),
+		Description: event.GetDescription(),
+		OwnerID:     event.GetOwnerId(),
+		RemindIn:    event.GetRemindIn(),
+		Timezone:    event.GetTimezone(),
+		AllDay:      event.GetAllDay(),
+		StartDay:    event.GetStartDay(),
+		EndDay:      event.GetEndDay(),
+	}
+	if event.GetStart() != nil {
+		e.StartDate = event.GetStart().GetSeconds()
 	}
+	if event.GetEnd() != nil {
+		e.EndDate = event.GetEnd().GetSeconds()
+	}
+	return e
 }
 
 func toPBEvent(event app.Event) *Event {
@@ -87,5 +176,39 @@ func toPBEvent(event app.Event) *Event {
 		Description: event.Description,
 		OwnerId:     event.OwnerID,
 		RemindIn:    event.RemindIn,
+		Start:       &timestamppb.Timestamp{Seconds: event.StartDate},
+		End:         &timestamppb.Timestamp{Seconds: event.EndDate},
+		Timezone:    event.Timezone,
+		AllDay:      event.AllDay,
+		StartDay:    event.StartDay,
+		EndDay:      event.EndDay,
+	}
+}
+
+func toPBEventHistoryRecord(record app.EventHistoryRecord) *EventHistoryRecord {
+	pbRecord := &EventHistoryRecord{
+		EventId: record.EventID,
+		Action:  string(record.Action),
+		Actor:   record.Actor,
+		Date:    record.Date,
+	}
+	if record.Before != nil {
+		pbRecord.Before = toPBEvent(*record.Before)
+	}
+	if record.After != nil {
+		pbRecord.After = toPBEvent(*record.After)
+	}
+	return pbRecord
+}
+
+func toPBEventChange(change app.EventChange) *EventChange {
+	pbChange := &EventChange{
+		Seq:    change.Seq,
+		Action: string(change.Action),
+		Event:  toPBEvent(change.Event),
+	}
+	if change.Before != nil {
+		pbChange.Before = toPBEvent(*change.Before)
 	}
+	return pbChange
 }
@@ -2,18 +2,34 @@ package grpcsrv
 
 import (
 	context "context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/auth"
 	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 	"github.com/stretchr/testify/require"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/runtime/protoimpl"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const bufSize = 1024 * 1024
@@ -23,9 +39,16 @@ var lis *bufconn.Listener
 type mockLogger struct {
 }
 
+func (m *mockLogger) Debug(msg string, fields ...zap.Field) {
+}
+
 func (m *mockLogger) Info(msg string, fields ...zap.Field) {
 }
 
+func (m *mockLogger) With(fields ...zap.Field) app.Logger {
+	return m
+}
+
 func (m *mockLogger) Warn(msg string, fields ...zap.Field) {
 }
 
@@ -231,6 +254,205 @@ func TestEventsFail(t *testing.T) {
 	require.Nil(t, resp)
 }
 
+func TestCreateEventWithTimestamps(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	start := time.Date(2040, 3, 1, 10, 0, 0, 0, time.UTC)
+	_, err := c.CreateEvent(ctx, &Event{
+		Id:       "unique_event_id_3",
+		Title:    "Event_Title_3",
+		Start:    timestamppb.New(start),
+		End:      timestamppb.New(start.Add(time.Hour)),
+		Timezone: "Europe/Moscow",
+	})
+	require.NoError(t, err)
+
+	resp, err := c.Events(ctx, &EventsQuery{From: start.Unix(), To: start.Unix()})
+	require.NoError(t, err)
+	require.Len(t, resp.Events, 1)
+	require.Equal(t, start.Unix(), resp.Events[0].StartDate)
+	require.Equal(t, start.Add(time.Hour).Unix(), resp.Events[0].EndDate)
+	require.True(t, start.Equal(resp.Events[0].Start.AsTime()))
+	require.Equal(t, "Europe/Moscow", resp.Events[0].Timezone)
+}
+
+func TestCreateEventInvalidTimezone(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	_, err := c.CreateEvent(context.Background(), &Event{Id: "unique_event_id_3", Timezone: "Mars/Olympus"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestEventHistorySuccess(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	_, err := c.RemoveEvent(ctx, &EventID{
+		state:         protoimpl.MessageState{},
+		sizeCache:     0,
+		unknownFields: nil,
+		Id:            "unique_event_id_1",
+	})
+
+	require.NoError(t, err)
+
+	resp, err := c.EventHistory(ctx, &EventID{
+		state:         protoimpl.MessageState{},
+		sizeCache:     0,
+		unknownFields: nil,
+		Id:            "unique_event_id_1",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, resp.Records, 1)
+	require.Equal(t, string(app.EventRemoved), resp.Records[0].Action)
+	require.Equal(t, "unique_event_id_1", resp.Records[0].Before.Id)
+	require.Nil(t, resp.Records[0].After)
+}
+
+func TestEventHistoryFail(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	resp, err := c.EventHistory(ctx, &EventID{
+		state:         protoimpl.MessageState{},
+		sizeCache:     0,
+		unknownFields: nil,
+		Id:            "NaN",
+	})
+
+	require.Error(t, err)
+	require.Nil(t, resp)
+}
+
+func TestWatchEventsSuccess(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.WatchEvents(ctx, &EventsQuery{
+		state:         protoimpl.MessageState{},
+		sizeCache:     0,
+		unknownFields: nil,
+		From:          0,
+		To:            0,
+		OwnerId:       "unique_owner_uid",
+		AfterSeq:      0,
+	})
+
+	require.NoError(t, err)
+
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	_, err = c.RemoveEvent(ctx, &EventID{
+		state:         protoimpl.MessageState{},
+		sizeCache:     0,
+		unknownFields: nil,
+		Id:            "unique_event_id_2",
+	})
+
+	require.NoError(t, err)
+
+	change, err := stream.Recv()
+
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), change.Seq)
+	require.Equal(t, string(app.EventRemoved), change.Action)
+	require.Equal(t, "unique_event_id_2", change.Event.Id)
+}
+
+func TestBulkEventsSuccess(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	stream, err := c.BulkEvents(ctx)
+
+	require.NoError(t, err)
+
+	ops := []*BulkOperation{
+		{Type: string(app.BulkCreate), Event: &Event{Id: "unique_event_id_3", Title: "Event_Title_3"}, Mode: string(app.BulkBestEffort)},
+		{Type: string(app.BulkUpdate), Event: &Event{Id: "unique_event_id_4", Title: "Event_Title_4"}},
+		{Type: string(app.BulkDelete), Event: &Event{Id: "unique_event_id_2"}},
+	}
+	for _, op := range ops {
+		require.NoError(t, stream.Send(op))
+	}
+
+	resp, err := stream.CloseAndRecv()
+
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 3)
+	require.Empty(t, resp.Results[0].Error)
+	require.NotEmpty(t, resp.Results[1].Error)
+	require.Empty(t, resp.Results[2].Error)
+	require.Equal(t, int32(2), resp.Results[2].Index)
+}
+
+func TestBulkEventsAborted(t *testing.T) {
+	s := grpcServer()
+	defer s.Stop()
+
+	c, conn := grpcClient()
+	defer conn.Close()
+
+	stream, err := c.BulkEvents(context.Background())
+	require.NoError(t, err)
+
+	ops := []*BulkOperation{
+		{Type: string(app.BulkCreate), Event: &Event{Id: "unique_event_id_3", Title: "Event_Title_3"}},
+		{Type: string(app.BulkCreate), Event: &Event{Id: "unique_event_id_1", Title: "Event_Title_1"}},
+	}
+	for _, op := range ops {
+		require.NoError(t, stream.Send(op))
+	}
+
+	_, err = stream.CloseAndRecv()
+	st := status.Convert(err)
+	require.Equal(t, codes.Aborted, st.Code())
+
+	var results *BulkResults
+	for _, d := range st.Details() {
+		if r, ok := d.(*BulkResults); ok {
+			results = r
+		}
+	}
+	require.NotNil(t, results)
+	require.Len(t, results.Results, 2)
+	require.NotEmpty(t, results.Results[0].Error)
+	require.NotEmpty(t, results.Results[1].Error)
+}
+
 func grpcServer() *grpc.Server {
 	store := memorystorage.New()
 	for _, e := range mockEvents() {
@@ -289,3 +511,178 @@ func mockEvents() []app.Event {
 		},
 	}
 }
+
+type pingStorage struct {
+	app.Storage
+	err error
+}
+
+func (s *pingStorage) Ping(ctx context.Context) error {
+	return s.err
+}
+
+func TestHealthStatus(t *testing.T) {
+	ctx := context.Background()
+	store := &pingStorage{Storage: memorystorage.New()}
+	srv := NewServer(NewAPI(app.New(&mockLogger{}, store)), "", "", &mockLogger{})
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := srv.health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	srv.updateHealth(ctx, srv.health)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(eventServiceName))
+
+	store.err = errors.New("connection refused")
+	srv.updateHealth(ctx, srv.health)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(eventServiceName))
+}
+
+func TestTracingInterceptor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := tracing.New("calendar", recorder, 0)
+	srv := NewServer(NewAPI(app.New(&mockLogger{}, memorystorage.New())), "", "", &mockLogger{})
+
+	md := metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.EventService/CreateEvent"}
+	_, err := srv.tracingInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "storage is down")
+	})
+	require.Error(t, err)
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "pb.EventService/CreateEvent", spans[0].Name())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	require.Equal(t, otelcodes.Error, spans[0].Status().Code)
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	srv := NewServer(NewAPI(app.New(&mockLogger{}, memorystorage.New())), "", "", &mockLogger{})
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.EventService/CreateEvent"}
+	requestID := func(ctx context.Context) string {
+		var id string
+		_, err := srv.requestIDInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			id = app.RequestIDFromContext(ctx)
+			return nil, nil
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	md := metadata.Pairs(requestIDMetadataKey, "client-request-id")
+	require.Equal(t, "client-request-id", requestID(metadata.NewIncomingContext(context.Background(), md)))
+	require.Len(t, requestID(context.Background()), 32)
+
+	long := strings.Repeat("a", 64)
+	md = metadata.Pairs(requestIDMetadataKey, long)
+	require.Equal(t, long, requestID(metadata.NewIncomingContext(context.Background(), md)))
+	for _, id := range []string{"id/with/slashes", "id\nnewline", long + "a"} {
+		md = metadata.Pairs(requestIDMetadataKey, id)
+		require.Len(t, requestID(metadata.NewIncomingContext(context.Background(), md)), 32, id)
+	}
+}
+
+func TestProtectionInterceptors(t *testing.T) {
+	srv := NewServer(
+		NewAPI(app.New(&mockLogger{}, memorystorage.New())),
+		"",
+		"",
+		&mockLogger{},
+		WithRateLimit(1, 1),
+		WithRequestTimeout(time.Second),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.EventService/CreateEvent"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}})
+
+	_, err := srv.recoveryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = srv.deadlineInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	_, err = srv.rateLimitInterceptor(ctx, nil, info, ok)
+	require.NoError(t, err)
+	_, err = srv.rateLimitInterceptor(ctx, nil, info, ok)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	authenticator, err := auth.New(config.AuthConf{Enabled: true, APIKeys: map[string]string{"key_1": "user_1"}})
+	require.NoError(t, err)
+	srv := NewServer(NewAPI(app.New(&mockLogger{}, memorystorage.New())), "", "", &mockLogger{}, WithAuthenticator(authenticator))
+	call := func(ctx context.Context, method string) (string, error) {
+		var userID string
+		_, err := srv.authInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			userID = app.UserFromContext(ctx)
+			return nil, nil
+		})
+		return userID, err
+	}
+
+	_, err = call(context.Background(), "/pb.EventService/CreateEvent")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apiKeyMetadataKey, "key_1"))
+	userID, err := call(ctx, "/pb.EventService/CreateEvent")
+	require.NoError(t, err)
+	require.Equal(t, "user_1", userID)
+
+	_, err = call(context.Background(), "/grpc.health.v1.Health/Check")
+	require.NoError(t, err)
+}
+
+func TestGateway(t *testing.T) {
+	gateway, err := NewGateway(context.Background(), NewAPI(app.New(&mockLogger{}, memorystorage.New())))
+	require.NoError(t, err)
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var data map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+		return resp.StatusCode, data
+	}
+
+	event := `{"id": "unique_event_id_1", "title": "Event_Title_1", "startDate": 100500, "endDate": 300800}`
+	code, _ := do(http.MethodPost, "/v1/events", event)
+	require.Equal(t, http.StatusOK, code)
+	code, body := do(http.MethodPost, "/v1/events", event)
+	require.Equal(t, http.StatusConflict, code)
+	require.Equal(t, float64(codes.AlreadyExists), body["code"])
+
+	code, _ = do(http.MethodPut, "/v1/events/unique_event_id_1", `{"title": "Event_Title_Updated", "startDate": 100500, "endDate": 300800}`)
+	require.Equal(t, http.StatusOK, code)
+
+	code, body = do(http.MethodGet, "/v1/events?from=100000&to=400000", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["events"], 1)
+	require.Equal(t, "Event_Title_Updated", body["events"].([]interface{})[0].(map[string]interface{})["title"])
+
+	code, _ = do(http.MethodDelete, "/v1/events/unique_event_id_1", "")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = do(http.MethodDelete, "/v1/events/unique_event_id_1", "")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body = do(http.MethodGet, OpenAPIPath, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body["paths"], "/v1/events/{id}")
+}
@@ -0,0 +1,37 @@
+package grpcsrv
+
+import (
+	"context"
+	_ "embed" // openapi document is generated next to the proto
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const OpenAPIPath = "/v1/openapi.json"
+
+//go:embed proto/EventService.swagger.json
+var openAPI []byte
+
+// NewGateway serves unary calls of api as json over http, so http clients get the same handlers
+// and error codes as grpc ones. Context values of the http request reach the handlers as is.
+func NewGateway(ctx context.Context, api EventServiceServer) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}, // nolint: exhaustivestruct
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},                     // nolint: exhaustivestruct
+		}),
+	)
+	if err := RegisterEventServiceHandlerServer(ctx, mux, api); err != nil {
+		return nil, &ServerError{Message: "can't register gateway handlers", Err: err}
+	}
+	err := mux.HandlePath(http.MethodGet, OpenAPIPath, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
+	if err != nil {
+		return nil, &ServerError{Message: "can't register openapi handler", Err: err}
+	}
+	return mux, nil
+}
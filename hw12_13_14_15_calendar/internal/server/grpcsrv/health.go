@@ -0,0 +1,42 @@
+package grpcsrv
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	healthCheckInterval = 5 * time.Second
+	eventServiceName    = "pb.EventService"
+)
+
+// watchHealth keeps grpc.health.v1 status of the server and EventService in sync with the storage.
+func (s *Server) watchHealth(ctx context.Context, hs *health.Server) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.updateHealth(ctx, hs)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) updateHealth(ctx context.Context, hs *health.Server) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckInterval)
+	defer cancel()
+
+	status := healthpb.HealthCheckResponse_SERVING
+	if err := s.api.application.Ping(ctx); err != nil {
+		s.log.Warn("storage is unavailable", s.log.String("msg", err.Error()))
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hs.SetServingStatus("", status)
+	hs.SetServingStatus(eventServiceName, status)
+}
@@ -2,17 +2,40 @@ package grpcsrv
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"path"
+	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	actorMetadataKey         = "x-user-id"
+	authorizationMetadataKey = "authorization"
+	apiKeyMetadataKey        = "x-api-key"
+	requestIDMetadataKey     = "x-request-id"
+	healthServicePrefix      = "/grpc.health.v1.Health/"
 )
 
 func (s *Server) loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	start := time.Now()
 
 	reply, err := handler(ctx, req)
+	metrics.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
 
-	s.log.Info(
+	app.LoggerFromContext(ctx, s.log).Info(
 		"[gRPC]",
 		s.log.String("method", info.FullMethod),
 		s.log.Duration("duration", time.Since(start)),
@@ -20,3 +43,233 @@ func (s *Server) loggingInterceptor(ctx context.Context, req interface{}, info *
 
 	return reply, err
 }
+
+func (s *Server) loggingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+	metrics.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+	app.LoggerFromContext(ss.Context(), s.log).Info(
+		"[gRPC]",
+		s.log.String("method", info.FullMethod),
+		s.log.Duration("duration", time.Since(start)),
+	)
+
+	return err
+}
+
+// tracingInterceptor continues the trace of traceparent metadata or starts a new one.
+func (s *Server) tracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (reply interface{}, err error) {
+	ctx, span := startSpan(ctx, info.FullMethod)
+	defer func() { endSpan(span, err) }()
+
+	return handler(ctx, req)
+}
+
+func (s *Server) tracingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, span := startSpan(ss.Context(), info.FullMethod)
+	defer func() { endSpan(span, err) }()
+
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+func startSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	name := strings.TrimPrefix(fullMethod, "/")
+	service, method := path.Split(name)
+	return tracing.Tracer().Start(
+		tracing.Extract(ctx, metadataCarrier(md)),
+		name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.RPCSystemKey.String("grpc"),
+			semconv.RPCServiceKey.String(strings.TrimSuffix(service, "/")),
+			semconv.RPCMethodKey.String(method),
+		),
+	)
+}
+
+// endSpan fails span on server side codes only, like rest does for 5xx.
+func endSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded, codes.Unimplemented:
+		tracing.End(span, err)
+	default:
+		span.End()
+	}
+}
+
+// metadataCarrier reads and writes the trace context in grpc metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// recoveryInterceptor turns a handler panic into codes.Internal, the server keeps working.
+func (s *Server) recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (reply interface{}, err error) {
+	defer s.recoverPanic(ctx, info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func (s *Server) recoveryStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer s.recoverPanic(ss.Context(), info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func (s *Server) recoverPanic(ctx context.Context, method string, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	app.LoggerFromContext(ctx, s.log).Error(
+		"[gRPC] panic",
+		s.log.String("method", method),
+		s.log.String("panic", fmt.Sprint(v)),
+		s.log.String("stack", string(debug.Stack())),
+	)
+	*err = status.Error(codes.Internal, "internal server error")
+}
+
+// rateLimitInterceptor limits every peer ip by its own token bucket.
+func (s *Server) rateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.allow(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) rateLimitStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.allow(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (s *Server) allow(ctx context.Context) error {
+	var client string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+	}
+	if ok, wait := s.limiter.Allow(client); !ok {
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry in %s", wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// deadlineInterceptor keeps the client deadline when it's shorter than the server one.
+func (s *Server) deadlineInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.opts.requestTimeout <= 0 {
+		return handler(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.opts.requestTimeout)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// requestIDInterceptor keeps a valid id sent by the client or generates a new one and returns it in the header.
+func (s *Server) requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestID(ctx), req)
+}
+
+func (s *Server) requestIDStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadataKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	id = app.RequestIDOrNew(id)
+	// the header is sent with the first response message, a failed one only loses the echo
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, id))
+	return app.ContextWithRequestID(ctx, id)
+}
+
+// authInterceptor puts the authenticated user into context as the owner of events,
+// without authenticator the actor metadata is trusted as before.
+func (s *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if s.opts.authenticator == nil {
+		if actor := first(actorMetadataKey); actor != "" {
+			ctx = app.ContextWithActor(ctx, actor)
+		}
+		return ctx, nil
+	}
+	// probes of orchestrator have no credentials
+	if strings.HasPrefix(fullMethod, healthServicePrefix) {
+		return ctx, nil
+	}
+
+	userID, err := s.opts.authenticator.Authenticate(first(authorizationMetadataKey), first(apiKeyMetadataKey))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return app.ContextWithUser(ctx, userID), nil
+}
+
+// sessionInterceptor lets storage read back the writes of the same call.
+func (s *Server) sessionInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(app.ContextWithSession(ctx), req)
+}
+
+func (s *Server) sessionStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: app.ContextWithSession(ss.Context())})
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,55 @@
+package grpcsrv
+
+import (
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/auth"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/certs"
+)
+
+type options struct {
+	rateLimit      float64
+	rateBurst      int
+	maxRecvMsgSize int
+	requestTimeout time.Duration
+	authenticator  *auth.Authenticator
+	certs          *certs.Reloader
+}
+
+type Option func(*options)
+
+// WithRateLimit allows every client rate calls per second with bursts up to burst, zero rate disables it.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = rate
+		o.rateBurst = burst
+	}
+}
+
+// WithMaxRecvMsgSize rejects request messages larger than n bytes, zero keeps the grpc default of 4MB.
+func WithMaxRecvMsgSize(n int) Option {
+	return func(o *options) {
+		o.maxRecvMsgSize = n
+	}
+}
+
+// WithRequestTimeout bounds unary calls without a shorter client deadline, streams are not limited.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = d
+	}
+}
+
+// WithAuthenticator requires a bearer jwt or an api key in metadata of every call except health checks.
+func WithAuthenticator(a *auth.Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = a
+	}
+}
+
+// WithTLS serves over tls with certificates of r, nil r keeps plain connections.
+func WithTLS(r *certs.Reloader) Option {
+	return func(o *options) {
+		o.certs = r
+	}
+}
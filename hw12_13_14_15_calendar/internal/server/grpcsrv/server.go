@@ -6,10 +6,14 @@ import (
 	"net"
 
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/limiter"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-//go:generate protoc ./proto/EventService.proto --go_out=. --go-grpc_out=.
+//go:generate protoc -I . -I ./proto/third_party ./proto/EventService.proto --go_out=. --go-grpc_out=. --grpc-gateway_out=. --openapiv2_out=.
 
 type ServerError struct {
 	Message string `json:"message"`
@@ -18,7 +22,7 @@ type ServerError struct {
 
 func (e *ServerError) Error() string {
 	if e.Err != nil {
-		e.Message = e.Message + " --> " + e.Err.Error()
+		return "[grpc] " + e.Message + " --> " + e.Err.Error()
 	}
 	return "[grpc] " + e.Message
 }
@@ -29,21 +33,60 @@ func (e *ServerError) Unwrap() error {
 type Server struct {
 	Address string
 	server  *grpc.Server
+	health  *health.Server
 	api     *API
 	log     app.Logger
+	opts    options
+	limiter *limiter.Limiter
 }
 
-func NewServer(api *API, host, port string, logger app.Logger) *Server {
-	return &Server{
+func NewServer(api *API, host, port string, logger app.Logger, opts ...Option) *Server {
+	s := &Server{
 		Address: net.JoinHostPort(host, port),
+		health:  health.NewServer(),
 		api:     api,
 		log:     logger,
 	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.limiter = limiter.New(s.opts.rateLimit, s.opts.rateBurst)
+	return s
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.loggingInterceptor))
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			s.tracingInterceptor,
+			s.requestIDInterceptor,
+			s.loggingInterceptor,
+			s.recoveryInterceptor,
+			s.rateLimitInterceptor,
+			s.deadlineInterceptor,
+			s.authInterceptor,
+			s.sessionInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			s.tracingStreamInterceptor,
+			s.requestIDStreamInterceptor,
+			s.loggingStreamInterceptor,
+			s.recoveryStreamInterceptor,
+			s.rateLimitStreamInterceptor,
+			s.authStreamInterceptor,
+			s.sessionStreamInterceptor,
+		),
+	}
+	if s.opts.certs != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.opts.certs.Config("h2"))))
+	}
+	if s.opts.maxRecvMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(s.opts.maxRecvMsgSize))
+	}
+	s.server = grpc.NewServer(serverOpts...)
 	RegisterEventServiceServer(s.server, s.api)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	go s.watchHealth(ctx, s.health)
+
 	lis, err := net.Listen("tcp", s.Address)
 	if err != nil {
 		return &ServerError{Message: "start listen error", Err: err}
@@ -62,6 +105,7 @@ func (s *Server) Stop() error {
 		return errors.New("grpc server is nil")
 	}
 
+	s.health.Shutdown()
 	s.server.GracefulStop()
 	return nil
 }
@@ -0,0 +1,44 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(100500, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		require.True(t, ok)
+	}
+	ok, wait := l.Allow("client")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("other")
+	require.True(t, ok, "clients have their own buckets")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+	ok, _ = l.Allow("client")
+	require.False(t, ok)
+
+	now = now.Add(time.Hour)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+	require.Len(t, l.buckets, 1, "idle buckets are swept")
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := New(0, 10)
+	require.Nil(t, l)
+
+	ok, _ := l.Allow("client")
+	require.True(t, ok)
+}
@@ -2,11 +2,15 @@ package rest
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/errmap"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
 )
 
@@ -23,10 +27,32 @@ type EventRemoveForm struct {
 }
 
 type EventsQueryForm struct {
-	From int64 `json:"from"`
-	To   int64 `json:"to"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	Timezone string `json:"tz" schema:"tz"`
 }
 
+type EventsBatchForm struct {
+	Mode       app.BulkMode        `json:"mode"`
+	Operations []app.BulkOperation `json:"operations"`
+}
+
+type WebhookRemoveForm struct {
+	WebhookID string `json:"id"`
+}
+
+type EventsWatchForm struct {
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	OwnerID  string `json:"owner_id" schema:"owner_id"`
+	AfterSeq uint64 `json:"after_seq" schema:"after_seq"`
+}
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+	keepAliveInterval = 15 * time.Second
+)
+
 type API struct {
 	application *app.App
 }
@@ -36,14 +62,14 @@ func NewAPI(application *app.App) *API {
 }
 
 func (a *API) createEvent(w http.ResponseWriter, r *http.Request) {
-	var event app.Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	var form EventForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
 		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
 		return
 	}
 
-	if err := a.application.CreateEvent(r.Context(), event); err != nil {
-		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't create event")
+	if err := a.application.CreateEvent(r.Context(), form.event()); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't create event")
 		return
 	}
 
@@ -51,18 +77,14 @@ func (a *API) createEvent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) updateEvent(w http.ResponseWriter, r *http.Request) {
-	var event app.Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	var form EventForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
 		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
 		return
 	}
 
-	if err := a.application.UpdateEvent(r.Context(), event); err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrEventDoesNotExist) {
-			statusCode = http.StatusNotFound
-		}
-		sendErrorJSON(w, r, statusCode, err, "can't update event")
+	if err := a.application.UpdateEvent(r.Context(), form.event()); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't update event")
 		return
 	}
 
@@ -77,11 +99,7 @@ func (a *API) removeEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := a.application.RemoveEvent(r.Context(), form.EventID); err != nil {
-		statusCode := http.StatusBadRequest
-		if errors.Is(err, storage.ErrEventDoesNotExist) {
-			statusCode = http.StatusNotFound
-		}
-		sendErrorJSON(w, r, statusCode, err, "can't remove event")
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't remove event")
 		return
 	}
 
@@ -95,22 +113,180 @@ func (a *API) events(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := a.callerLocation(r, query.Timezone)
+	if err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't query params")
+		return
+	}
+
 	events, err := a.application.Events(r.Context(), query.From, query.To)
 	if err != nil {
-		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't get events")
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get events")
 		return
 	}
 
 	if len(events) == 0 {
-		sendErrorJSON(w, r, http.StatusNotFound, err, "can't get events")
+		sendErrorJSON(w, r, http.StatusNotFound, storage.ErrNoEvents, "can't get events")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, newEventViews(events, loc))
+}
+
+func (a *API) eventsBatch(w http.ResponseWriter, r *http.Request) {
+	var form EventsBatchForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	results, err := a.application.BulkApply(r.Context(), form.Operations, form.Mode)
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't apply operations")
+		return
+	}
+
+	if app.BulkAborted(form.Mode, results) {
+		status(r, errmap.HTTPStatus(app.ErrBulkAborted))
+		sendJSON(w, r, Response{Data: results, Error: JSON{"message": "batch is aborted", "code": app.CodeOf(app.ErrBulkAborted)}})
 		return
 	}
 
-	sendDataJSON(w, r, http.StatusOK, events)
+	sendDataJSON(w, r, http.StatusOK, results)
+}
+
+func (a *API) eventHistory(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	records, err := a.application.EventHistory(r.Context(), eventID)
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get event history")
+		return
+	}
+
+	if len(records) == 0 {
+		sendErrorJSON(w, r, http.StatusNotFound, storage.ErrEventDoesNotExist, "can't get event history")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, records)
+}
+
+func (a *API) watchEvents(w http.ResponseWriter, r *http.Request) {
+	var query EventsWatchForm
+	if err := schema.NewDecoder().Decode(&query, r.URL.Query()); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't query params")
+		return
+	}
+
+	if lastID := r.Header.Get(lastEventIDHeader); lastID != "" {
+		seq, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse "+lastEventIDHeader)
+			return
+		}
+		query.AfterSeq = seq
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorJSON(w, r, http.StatusInternalServerError, nil, "streaming is not supported")
+		return
+	}
+
+	filter := app.ChangeFilter{OwnerID: query.OwnerID, From: query.From, To: query.To}
+	changes, err := a.application.WatchEvents(r.Context(), filter, query.AfterSeq)
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't watch events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(change)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq, change.Action, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
 }
 
+func (a *API) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook app.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	if err := a.application.CreateWebhook(r.Context(), webhook); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't create webhook")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, nil)
+}
+
+func (a *API) removeWebhook(w http.ResponseWriter, r *http.Request) {
+	var form WebhookRemoveForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	if err := a.application.RemoveWebhook(r.Context(), form.WebhookID); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't remove webhook")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, nil)
+}
+
+func (a *API) webhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := a.application.Webhooks(r.Context())
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get webhooks")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, webhooks)
+}
+
+func (a *API) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["id"]
+
+	deliveries, err := a.application.WebhookDeliveries(r.Context(), webhookID)
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get webhook deliveries")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, deliveries)
+}
+
+// Routes are the legacy rpc style routes followed by the events resource.
 func (a *API) Routes() []Route {
-	return []Route{
+	routes := []Route{
 		{
 			Name:   "CreateEvent",
 			Method: http.MethodPost,
@@ -135,5 +311,61 @@ func (a *API) Routes() []Route {
 			Path:   "/events",
 			Func:   a.events,
 		},
+		{
+			Name:   "EventsBatch",
+			Method: http.MethodPost,
+			Path:   "/events/batch",
+			Func:   a.eventsBatch,
+		},
+		{
+			Name:   "EventHistory",
+			Method: http.MethodGet,
+			Path:   "/event/{id}/history",
+			Func:   a.eventHistory,
+		},
+		{
+			Name:   "WatchEvents",
+			Method: http.MethodGet,
+			Path:   "/events/watch",
+			Func:   a.watchEvents,
+			Stream: true,
+		},
+		{
+			Name:   "CreateWebhook",
+			Method: http.MethodPost,
+			Path:   "/webhook/create",
+			Func:   a.createWebhook,
+		},
+		{
+			Name:   "RemoveWebhook",
+			Method: http.MethodPost,
+			Path:   "/webhook/remove",
+			Func:   a.removeWebhook,
+		},
+		{
+			Name:   "Webhooks",
+			Method: http.MethodGet,
+			Path:   "/webhooks",
+			Func:   a.webhooks,
+		},
+		{
+			Name:   "WebhookDeliveries",
+			Method: http.MethodGet,
+			Path:   "/webhook/{id}/deliveries",
+			Func:   a.webhookDeliveries,
+		},
+		{
+			Name:   "SetUserTimezone",
+			Method: http.MethodPost,
+			Path:   "/user/timezone",
+			Func:   a.setUserTimezone,
+		},
+		{
+			Name:   "UserTimezone",
+			Method: http.MethodGet,
+			Path:   "/user/timezone",
+			Func:   a.userTimezone,
+		},
 	}
+	return append(routes, a.eventRoutes()...)
 }
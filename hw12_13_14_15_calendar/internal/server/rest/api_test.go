@@ -1,27 +1,45 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/auth"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
 	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type mockLogger struct {
 }
 
+func (m *mockLogger) Debug(msg string, fields ...zap.Field) {
+}
+
 func (m *mockLogger) Info(msg string, fields ...zap.Field) {
 }
 
+func (m *mockLogger) With(fields ...zap.Field) app.Logger {
+	return m
+}
+
 func (m *mockLogger) Warn(msg string, fields ...zap.Field) {
 }
 
@@ -83,13 +101,14 @@ func TestCreateEventFailStore(t *testing.T) {
 
 	resp, err = http.Post(server.URL+"/event/create", "application/json", bytes.NewReader(data))
 	require.NoError(t, err)
-	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
 
 	var parsedResp Response
 	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
 	require.NoError(t, err)
 	require.Nil(t, parsedResp.Data)
 	require.NotNil(t, parsedResp.Error)
+	require.Equal(t, "event_already_exists", parsedResp.Error["code"])
 }
 
 func TestCreateEventInvalidData(t *testing.T) {
@@ -252,7 +271,7 @@ func TestEventsFailStore(t *testing.T) {
 
 	resp, err := http.Get(server.URL + "/events?from=900800&to=10000200")
 	require.NoError(t, err)
-	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 
 	var parsedResp Response
 	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
@@ -276,6 +295,744 @@ func TestEventsInvalidData(t *testing.T) {
 	require.NotNil(t, parsedResp.Error)
 }
 
+func TestCreateEventRFC3339(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	data := []byte(`{"id":"unique_event_id_3","title":"Event_Title_3",` +
+		`"start":"2040-03-01T13:00:00+03:00","end":"2040-03-01T14:00:00+03:00","timezone":"Europe/Moscow"}`)
+	resp, err := http.Post(server.URL+"/event/create", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	start := time.Date(2040, 3, 1, 10, 0, 0, 0, time.UTC).Unix()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events?from="+strconv.FormatInt(start, 10)+
+		"&to="+strconv.FormatInt(start, 10)+"&tz=America/New_York", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Events []EventView `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.Len(t, parsedResp.Events, 1)
+	require.Equal(t, start, parsedResp.Events[0].StartDate)
+	require.Equal(t, "2040-03-01T05:00:00-05:00", parsedResp.Events[0].Start)
+	require.Equal(t, "2040-03-01T06:00:00-05:00", parsedResp.Events[0].End)
+	require.Equal(t, "Europe/Moscow", parsedResp.Events[0].Timezone)
+}
+
+func TestCreateEventInvalidTimezone(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	data, err := json.Marshal(&app.Event{ID: "unique_event_id_3", Timezone: "Mars/Olympus"})
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+"/event/create", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestEventsInUserTimezone(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/user/timezone", strings.NewReader(`{"timezone":"Asia/Tokyo"}`))
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, server.URL+"/user/timezone", nil)
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tzResp struct {
+		Data UserTimezoneForm `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tzResp))
+	require.Equal(t, "Asia/Tokyo", tzResp.Data.Timezone)
+
+	req, err = http.NewRequest(http.MethodGet, server.URL+"/events?from=300800&to=500200", nil)
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Events []EventView `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&parsedResp))
+	require.Len(t, parsedResp.Events, 1)
+	require.Equal(t, "1970-01-04T20:33:20+09:00", parsedResp.Events[0].Start)
+
+	req.Header.Set(timezoneHeader, "UTC")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&parsedResp))
+	require.Equal(t, "1970-01-04T11:33:20Z", parsedResp.Events[0].Start)
+}
+
+func TestSetUserTimezoneInvalidData(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/user/timezone", "application/json", strings.NewReader(`{"timezone":"UTC"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/user/timezone", strings.NewReader(`{"timezone":"Mars/Olympus"}`))
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// timezoneDownStore fails user timezone calls the way an unreachable db does.
+type timezoneDownStore struct {
+	*memorystorage.EventDataStore
+}
+
+func (s timezoneDownStore) SetUserTimezone(context.Context, string, string) error {
+	return &app.BaseError{Kind: app.KindUnavailable, Message: "db is down"}
+}
+
+func (s timezoneDownStore) UserTimezone(context.Context, string) (string, error) {
+	return "", &app.BaseError{Kind: app.KindUnavailable, Message: "db is down"}
+}
+
+func TestUserTimezoneStoreUnavailable(t *testing.T) {
+	a := app.New(&mockLogger{}, timezoneDownStore{memorystorage.New()})
+	server := httptest.NewServer(NewServer(NewAPI(a), a, "", "", &mockLogger{}).router())
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/user/timezone", strings.NewReader(`{"timezone":"UTC"}`))
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, server.URL+"/user/timezone", nil)
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_owner_uid")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestAllDayEvent(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	data := []byte(`{"id":"unique_event_id_3","title":"Event_Title_3","all_day":true,` +
+		`"start_day":"2040-03-01","end_day":"2040-03-03","timezone":"Asia/Tokyo"}`)
+	resp, err := http.Post(server.URL+"/event/create", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the window covers only the second day, the event started before it
+	from := time.Date(2040, 3, 2, 0, 0, 0, 0, time.UTC).Unix()
+	resp, err = http.Get(server.URL + "/events?from=" + strconv.FormatInt(from, 10) + "&to=" + strconv.FormatInt(from+3600, 10))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Events []EventView `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&parsedResp))
+	require.Len(t, parsedResp.Events, 1)
+	require.True(t, parsedResp.Events[0].AllDay)
+	require.Equal(t, "2040-03-01", parsedResp.Events[0].Start)
+	require.Equal(t, "2040-03-03", parsedResp.Events[0].End)
+	require.Equal(t, time.Date(2040, 3, 1, 0, 0, 0, 0, loadLocation(t, "Asia/Tokyo")).Unix(), parsedResp.Events[0].StartDate)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestEventsBatchSuccess(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	form := EventsBatchForm{
+		Mode: app.BulkBestEffort,
+		Operations: []app.BulkOperation{
+			{Type: app.BulkCreate, Event: app.Event{ID: "unique_event_id_3", Title: "Event_Title_3"}},
+			{Type: app.BulkDelete, Event: app.Event{ID: "unique_event_id_10"}},
+			{Type: app.BulkDelete, Event: app.Event{ID: "unique_event_id_1"}},
+		},
+	}
+	data, err := json.Marshal(&form)
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+"/events/batch", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Results []app.BulkResult `json:"data"`
+		Error   JSON             `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.Nil(t, parsedResp.Error)
+	require.Len(t, parsedResp.Results, 3)
+	require.Empty(t, parsedResp.Results[0].Error)
+	require.NotEmpty(t, parsedResp.Results[1].Error)
+	require.Empty(t, parsedResp.Results[2].Error)
+}
+
+func TestEventsBatchAborted(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	form := EventsBatchForm{
+		Operations: []app.BulkOperation{
+			{Type: app.BulkCreate, Event: app.Event{ID: "unique_event_id_3", Title: "Event_Title_3"}},
+			{Type: app.BulkCreate, Event: app.Event{ID: "unique_event_id_1", Title: "Event_Title_1"}},
+		},
+	}
+	data, err := json.Marshal(&form)
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+"/events/batch", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var parsedResp struct {
+		Results []app.BulkResult `json:"data"`
+		Error   JSON             `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.NotNil(t, parsedResp.Error)
+	require.Len(t, parsedResp.Results, 2)
+	require.NotEmpty(t, parsedResp.Results[0].Error)
+	require.NotEmpty(t, parsedResp.Results[1].Error)
+
+	resp, err = http.Get(server.URL + "/events?from=0&to=1000000")
+	require.NoError(t, err)
+
+	var eventsResp struct {
+		Events []app.Event `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&eventsResp)
+	require.NoError(t, err)
+	require.Len(t, eventsResp.Events, 2)
+}
+
+func TestEventHistorySuccess(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	event := mockEvents()[0]
+	event.Title = "Event_Title_Updated"
+
+	data, err := json.Marshal(&event)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/event/update", bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "unique_actor_uid")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/event/" + event.ID + "/history")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Records []app.EventHistoryRecord `json:"data"`
+		Error   JSON                     `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.Nil(t, parsedResp.Error)
+	require.Len(t, parsedResp.Records, 1)
+	require.Equal(t, app.EventUpdated, parsedResp.Records[0].Action)
+	require.Equal(t, "unique_actor_uid", parsedResp.Records[0].Actor)
+	require.Equal(t, "Event_Title_1", parsedResp.Records[0].Before.Title)
+	require.Equal(t, event.Title, parsedResp.Records[0].After.Title)
+}
+
+func TestEventHistoryNotFound(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/event/unique_event_id_1/history")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var parsedResp Response
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.Nil(t, parsedResp.Data)
+	require.NotNil(t, parsedResp.Error)
+	require.Equal(t, "event_not_found", parsedResp.Error["code"])
+}
+
+func TestWatchEventsSuccess(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events/watch?owner_id=unique_owner_uid&from=100500&to=200000")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	for _, e := range mockEvents() {
+		e.Title = "Event_Title_Updated"
+		data, err := json.Marshal(&e)
+		require.NoError(t, err)
+
+		updResp, err := http.Post(server.URL+"/event/update", "application/json", bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, updResp.StatusCode)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	require.Equal(t, "id: 1", lines[0])
+	require.Equal(t, "event: updated", lines[1])
+
+	var change app.EventChange
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &change)
+	require.NoError(t, err)
+	require.Equal(t, "unique_event_id_1", change.Event.ID)
+	require.Equal(t, "Event_Title_Updated", change.Event.Title)
+}
+
+func TestWatchEventsExpiredSeq(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events/watch", nil)
+	require.NoError(t, err)
+	req.Header.Set(lastEventIDHeader, "100")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestWebhookManagement(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	webhook := app.Webhook{
+		ID:      "unique_webhook_id",
+		URL:     "http://example.com/hook",
+		Secret:  "secret",
+		Actions: []app.EventAction{app.EventCreated},
+	}
+	data, err := json.Marshal(&webhook)
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+"/webhook/create", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/webhooks")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var parsedResp struct {
+		Webhooks []app.Webhook `json:"data"`
+		Error    JSON          `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsedResp)
+	require.NoError(t, err)
+	require.Len(t, parsedResp.Webhooks, 1)
+	require.Equal(t, webhook.URL, parsedResp.Webhooks[0].URL)
+	require.Empty(t, parsedResp.Webhooks[0].Secret)
+
+	resp, err = http.Get(server.URL + "/webhook/unique_webhook_id/deliveries")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	data, err = json.Marshal(&WebhookRemoveForm{WebhookID: webhook.ID})
+	require.NoError(t, err)
+
+	resp, err = http.Post(server.URL+"/webhook/remove", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/webhook/remove", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/webhook/unique_webhook_id/deliveries")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCreateWebhookInvalidData(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	data, err := json.Marshal(&app.Webhook{ID: "unique_webhook_id", URL: "/relative"})
+	require.NoError(t, err)
+
+	resp, err := http.Post(server.URL+"/webhook/create", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestHealthProbes(t *testing.T) {
+	pingErr := errors.New("connection refused")
+	a := app.New(&mockLogger{}, memorystorage.New())
+	for _, tc := range []struct {
+		name   string
+		path   string
+		ping   error
+		status int
+	}{
+		{name: "alive", path: "/healthz", ping: pingErr, status: http.StatusOK},
+		{name: "ready", path: "/readyz", status: http.StatusOK},
+		{name: "not ready", path: "/readyz", ping: pingErr, status: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ping := tc.ping
+			srv := NewServer(NewAPI(a), pingFunc(func(ctx context.Context) error { return ping }), "", "", &mockLogger{})
+			server := httptest.NewServer(srv.router())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + tc.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?from=300800&to=500200")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// metrics are served by the admin server only
+	resp, err = http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body bytes.Buffer
+	_, err = body.ReadFrom(rec.Body)
+	require.NoError(t, err)
+	require.Contains(t, body.String(), "calendar_rest_request_duration_seconds")
+}
+
+func TestTracingContinuesTraceparent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := tracing.New("calendar", recorder, 0)
+	server := testServer(true)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events?from=300800&to=500200", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}
+
+func TestRequestID(t *testing.T) {
+	server := testServer(true)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events?from=300800&to=500200", nil)
+	require.NoError(t, err)
+	req.Header.Set(requestIDHeader, "client-request-id")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "client-request-id", resp.Header.Get(requestIDHeader))
+
+	resp, err = http.Get(server.URL + "/events?from=300800&to=500200")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Len(t, resp.Header.Get(requestIDHeader), 32)
+
+	for _, id := range []string{"id with spaces", "id\"quoted\"", strings.Repeat("a", 65)} {
+		req.Header.Set(requestIDHeader, id)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Len(t, resp.Header.Get(requestIDHeader), 32, id)
+	}
+}
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]zap.Field
+}
+
+// recordLogger keeps access log entries, the field helpers build real fields.
+type recordLogger struct {
+	mockLogger
+	entries []logEntry
+}
+
+func (l *recordLogger) record(level, msg string, fields []zap.Field) {
+	e := logEntry{level: level, msg: msg, fields: make(map[string]zap.Field, len(fields))}
+	for _, f := range fields {
+		e.fields[f.Key] = f
+	}
+	l.entries = append(l.entries, e)
+}
+
+func (l *recordLogger) Info(msg string, fields ...zap.Field)  { l.record("info", msg, fields) }
+func (l *recordLogger) Warn(msg string, fields ...zap.Field)  { l.record("warn", msg, fields) }
+func (l *recordLogger) Error(msg string, fields ...zap.Field) { l.record("error", msg, fields) }
+func (l *recordLogger) With(fields ...zap.Field) app.Logger   { return l }
+func (l *recordLogger) String(key string, val string) zap.Field {
+	return zap.String(key, val)
+}
+func (l *recordLogger) Int64(key string, val int64) zap.Field { return zap.Int64(key, val) }
+func (l *recordLogger) Duration(key string, val time.Duration) zap.Field {
+	return zap.Duration(key, val)
+}
+
+func TestAccessLog(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  int
+		delay   time.Duration
+		entries []string
+	}{
+		{name: "ok sampled", status: http.StatusOK, entries: []string{"info", "info"}},
+		{name: "client error", status: http.StatusNotFound, entries: []string{"warn", "warn", "warn"}},
+		{name: "server error", status: http.StatusInternalServerError, entries: []string{"error", "error", "error"}},
+		{name: "slow", status: http.StatusOK, delay: 20 * time.Millisecond, entries: []string{"warn", "warn", "warn"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logg := &recordLogger{}
+			srv := NewServer(
+				NewAPI(app.New(logg, memorystorage.New())),
+				nil,
+				"",
+				"",
+				logg,
+				WithAccessLogSampling(2),
+				WithSlowRequestThreshold(10*time.Millisecond),
+			)
+			handler := srv.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tc.delay)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte("body"))
+			}))
+
+			for i := 0; i < 3; i++ {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+			}
+
+			require.Len(t, logg.entries, len(tc.entries))
+			for i, e := range logg.entries {
+				require.Equal(t, tc.entries[i], e.level)
+				require.Equal(t, int64(tc.status), e.fields["status"].Integer)
+				require.Equal(t, int64(4), e.fields["bytes"].Integer)
+				require.GreaterOrEqual(t, e.fields["duration"].Integer, int64(tc.delay))
+			}
+		})
+	}
+}
+
+func TestProtectionMiddleware(t *testing.T) {
+	logg := &recordLogger{}
+	srv := NewServer(
+		NewAPI(app.New(logg, memorystorage.New())),
+		nil,
+		"",
+		"",
+		logg,
+		WithRateLimit(1, 2),
+		WithMaxBodySize(8),
+	)
+	handler := alice.New(srv.recoveryMiddleware, srv.rateLimitMiddleware, srv.bodyLimitMiddleware).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("boom")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(httptest.NewRequest(http.MethodGet, "/panic", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "error", logg.entries[0].level)
+
+	w = serve(httptest.NewRequest(http.MethodPost, "/event/create", strings.NewReader("too large body")))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = serve(httptest.NewRequest(http.MethodGet, "/events", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	other := httptest.NewRequest(http.MethodGet, "/events", nil)
+	other.RemoteAddr = "10.0.0.1:4242"
+	w = serve(other)
+	require.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAuthentication(t *testing.T) {
+	authenticator, err := auth.New(config.AuthConf{Enabled: true, APIKeys: map[string]string{"key_1": "user_1", "key_2": "user_2"}})
+	require.NoError(t, err)
+	a := app.New(&mockLogger{}, memorystorage.New())
+	server := httptest.NewServer(NewServer(NewAPI(a), a, "", "", &mockLogger{}, WithAuthenticator(authenticator)).router())
+	defer server.Close()
+
+	post := func(path, apiKey string, e app.Event) *http.Response {
+		data, err := json.Marshal(&e)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(data))
+		require.NoError(t, err)
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	event := app.Event{ID: "unique_event_id_1", Title: "Event_Title_1", StartDate: 100500, EndDate: 300800}
+
+	resp := post("/event/create", "", event)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+	require.Equal(t, http.StatusUnauthorized, post("/event/create", "unknown", event).StatusCode)
+
+	require.Equal(t, http.StatusOK, post("/event/create", "key_1", event).StatusCode)
+	created, err := a.Event(context.Background(), event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "user_1", created.OwnerID)
+
+	require.Equal(t, http.StatusForbidden, post("/event/update", "key_2", event).StatusCode)
+	require.Equal(t, http.StatusOK, post("/event/update", "key_1", event).StatusCode)
+}
+
+func TestGatewayBehindMiddlewares(t *testing.T) {
+	a := app.New(&mockLogger{}, memorystorage.New())
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(app.ActorFromContext(r.Context())))
+	})
+	server := httptest.NewServer(NewServer(NewAPI(a), a, "", "", &mockLogger{}, WithGateway("/v1/", gateway)).router())
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/events", nil)
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "user_1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "user_1", string(body))
+	require.NotEmpty(t, resp.Header.Get(requestIDHeader))
+}
+
+func TestEventsResource(t *testing.T) {
+	server := testServer(false)
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	decode := func(resp *http.Response) Response {
+		var body Response
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body
+	}
+
+	resp := do(http.MethodGet, "/api/v1/events?from=100000&to=400000", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []interface{}{}, decode(resp).Data)
+
+	resp = do(http.MethodPost, "/api/v1/events", `{"title": "Event_Title_1", "start_date": 100500, "end_date": 300800}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := decode(resp).Data.(map[string]interface{})["id"].(string)
+	require.NotEmpty(t, id)
+	location := resp.Header.Get("Location")
+	require.Equal(t, "/api/v1/events/"+id, location)
+
+	resp = do(http.MethodPost, "/api/v1/events", `{"id": "`+id+`", "start_date": 100500, "end_date": 300800}`)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = do(http.MethodPut, location, `{"title": "Event_Title_Updated", "start_date": 100500, "end_date": 300800}`)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(http.MethodPut, location, `{"id": "other", "start_date": 100500, "end_date": 300800}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = do(http.MethodGet, location, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "Event_Title_Updated", decode(resp).Data.(map[string]interface{})["title"])
+
+	resp = do(http.MethodGet, "/api/v1/events?from=100000&to=400000", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, decode(resp).Data, 1)
+
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, location, "").StatusCode)
+	require.Equal(t, http.StatusNotFound, do(http.MethodDelete, location, "").StatusCode)
+	require.Equal(t, http.StatusNotFound, do(http.MethodGet, location, "").StatusCode)
+	require.Equal(t, http.StatusNotFound, do(http.MethodPut, location, `{"start_date": 100500, "end_date": 300800}`).StatusCode)
+}
+
 func testServer(prepareData bool) *httptest.Server {
 	store := memorystorage.New()
 	if prepareData {
@@ -285,17 +1042,9 @@ func testServer(prepareData bool) *httptest.Server {
 	}
 	a := app.New(&mockLogger{}, store)
 	api := NewAPI(a)
+	srv := NewServer(api, a, "", "", &mockLogger{})
 
-	router := mux.NewRouter()
-	for _, route := range api.Routes() {
-		router.
-			Methods(route.Method).
-			Path(route.Path).
-			Name(route.Name).
-			Handler(route.Func)
-	}
-
-	return httptest.NewServer(router)
+	return httptest.NewServer(srv.router())
 }
 
 func mockEvents() []app.Event {
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/errmap"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+)
+
+// eventsPath is the events resource, the event id is taken from the path instead of the body.
+const eventsPath = "/api/v1/events"
+
+var errIDMismatch = errors.New("id of the body differs from the path")
+
+func (a *API) eventRoutes() []Route {
+	return []Route{
+		{
+			Name:   "ListEventsV1",
+			Method: http.MethodGet,
+			Path:   eventsPath,
+			Func:   a.listEvents,
+		},
+		{
+			Name:   "CreateEventV1",
+			Method: http.MethodPost,
+			Path:   eventsPath,
+			Func:   a.postEvent,
+		},
+		{
+			Name:   "GetEventV1",
+			Method: http.MethodGet,
+			Path:   eventsPath + "/{id}",
+			Func:   a.getEvent,
+		},
+		{
+			Name:   "UpdateEventV1",
+			Method: http.MethodPut,
+			Path:   eventsPath + "/{id}",
+			Func:   a.putEvent,
+		},
+		{
+			Name:   "RemoveEventV1",
+			Method: http.MethodDelete,
+			Path:   eventsPath + "/{id}",
+			Func:   a.deleteEvent,
+		},
+	}
+}
+
+// listEvents answers an empty list when nothing is found, the collection itself exists.
+func (a *API) listEvents(w http.ResponseWriter, r *http.Request) {
+	var query EventsQueryForm
+	if err := schema.NewDecoder().Decode(&query, r.URL.Query()); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't query params")
+		return
+	}
+
+	loc, err := a.callerLocation(r, query.Timezone)
+	if err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't query params")
+		return
+	}
+
+	events, err := a.application.Events(r.Context(), query.From, query.To)
+	if err != nil && !errors.Is(err, storage.ErrNoEvents) {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get events")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, newEventViews(events, loc))
+}
+
+// postEvent assigns an id when the body has none and points Location to the new event.
+func (a *API) postEvent(w http.ResponseWriter, r *http.Request) {
+	var form EventForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	e := form.event()
+	if e.ID == "" {
+		e.ID = app.NewEventID()
+	}
+	if err := a.application.CreateEvent(r.Context(), e); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't create event")
+		return
+	}
+
+	w.Header().Set("Location", eventsPath+"/"+url.PathEscape(e.ID))
+	sendDataJSON(w, r, http.StatusCreated, JSON{"id": e.ID})
+}
+
+func (a *API) getEvent(w http.ResponseWriter, r *http.Request) {
+	loc, err := a.callerLocation(r, r.URL.Query().Get("tz"))
+	if err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't query params")
+		return
+	}
+
+	e, err := a.application.Event(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get event")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, newEventViews([]app.Event{e}, loc)[0])
+}
+
+func (a *API) putEvent(w http.ResponseWriter, r *http.Request) {
+	var form EventForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	e := form.event()
+	id := mux.Vars(r)["id"]
+	if e.ID != "" && e.ID != id {
+		sendErrorJSON(w, r, http.StatusBadRequest, errIDMismatch, "can't update event")
+		return
+	}
+	e.ID = id
+	if err := a.application.UpdateEvent(r.Context(), e); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't update event")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	if err := a.application.RemoveEvent(r.Context(), mux.Vars(r)["id"]); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't remove event")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// healthz is the liveness probe, the process is alive while it serves http.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	sendDataJSON(w, r, http.StatusOK, JSON{"status": "ok"})
+}
+
+// readyz is the readiness probe, the server is ready while the storage answers.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := s.app.Ping(ctx); err != nil {
+		sendErrorJSON(w, r, http.StatusServiceUnavailable, err, "storage is unavailable")
+		return
+	}
+	sendDataJSON(w, r, http.StatusOK, JSON{"status": "ready"})
+}
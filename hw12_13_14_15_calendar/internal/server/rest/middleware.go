@@ -1,24 +1,238 @@
 package rest
 
 import (
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
 	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	actorHeader     = "X-User-ID"
+	apiKeyHeader    = "X-API-Key"
+	requestIDHeader = "X-Request-ID"
 )
 
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			duration := time.Since(start)
+			metrics.ObserveREST(routeName(r), r.Method, sw.status, duration)
+			s.logRequest(r, sw, duration)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// logRequest writes 5xx at error level, 4xx and slow requests at warn level and samples the rest.
+func (s *Server) logRequest(r *http.Request, sw *statusWriter, duration time.Duration) {
+	log := app.LoggerFromContext(r.Context(), s.log)
+	slow := s.opts.slowRequest > 0 && duration >= s.opts.slowRequest
+
+	write := log.Info
+	switch {
+	case sw.status >= http.StatusInternalServerError:
+		write = log.Error
+	case sw.status >= http.StatusBadRequest || slow:
+		write = log.Warn
+	case !s.sampled():
+		return
+	}
+
+	msg := "[REST]"
+	if slow {
+		msg = "[REST] slow request"
+	}
+	write(
+		msg,
+		s.log.String("addr", r.RemoteAddr),
+		s.log.String("method", r.Method),
+		s.log.String("path", r.URL.Path),
+		s.log.String("proto", r.Proto),
+		s.log.Int64("status", int64(sw.status)),
+		s.log.Int64("bytes", sw.bytes),
+		s.log.Duration("duration", duration),
+		s.log.String("user agent", r.UserAgent()),
+	)
+}
+
+func (s *Server) sampled() bool {
+	if s.opts.accessLogSampleEvery == 0 {
+		return true
+	}
+	return atomic.AddUint64(&s.requests, 1)%s.opts.accessLogSampleEvery == 1
+}
+
+// tracingMiddleware continues the trace of traceparent header or starts a new one.
+func (s *Server) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Tracer().Start(
+			tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header)),
+			routeName(r),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("calendar", routePath(r), r)...),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sw.status)...)
+		// 4xx are answers to the client, only server failures mark the span
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// routeName keeps metric labels bounded, the path may contain ids.
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil && route.GetName() != "" {
+		return route.GetName()
+	}
+	return "unknown"
+}
+
+func routePath(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if path, err := route.GetPathTemplate(); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// statusWriter remembers the response status and size, it stays http.Flusher for event streams.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// recoveryMiddleware turns a handler panic into 500, the connection is not dropped.
+func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			start := time.Now()
-			s.log.Info(
-				"[REST]",
-				s.log.String("addr", r.RemoteAddr),
-				s.log.String("method", r.Method),
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler { // nolint: errorlint, goerr113
+				panic(v)
+			}
+			app.LoggerFromContext(r.Context(), s.log).Error(
+				"[REST] panic",
 				s.log.String("path", r.URL.Path),
-				s.log.String("proto", r.Proto),
-				s.log.Duration("duration", time.Since(start)),
-				s.log.String("user agent", r.UserAgent()),
+				s.log.String("panic", fmt.Sprint(v)),
+				s.log.String("stack", string(debug.Stack())),
 			)
+			sendErrorJSON(w, r, http.StatusInternalServerError, nil, "internal server error")
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
+
+// rateLimitMiddleware limits every client ip by its own token bucket.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := s.limiter.Allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			sendErrorJSON(w, r, http.StatusTooManyRequests, nil, "too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyLimitMiddleware rejects a known too large body at once, a chunked one fails on reading.
+func (s *Server) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.maxBodySize > 0 {
+			if r.ContentLength > s.opts.maxBodySize {
+				sendErrorJSON(w, r, http.StatusRequestEntityTooLarge, nil, "request body is too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, s.opts.maxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDMiddleware keeps a valid id sent by the client or generates a new one and returns it in the response.
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.RequestIDOrNew(r.Header.Get(requestIDHeader))
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(app.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// authMiddleware puts the authenticated user into context as the owner of events,
+// without authenticator the actor header is trusted as before.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.authenticator == nil {
+			if actor := r.Header.Get(actorHeader); actor != "" {
+				r = r.WithContext(app.ContextWithActor(r.Context(), actor))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := s.opts.authenticator.Authenticate(r.Header.Get("Authorization"), r.Header.Get(apiKeyHeader))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="calendar"`)
+			sendErrorJSON(w, r, http.StatusUnauthorized, err, "unauthenticated")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(app.ContextWithUser(r.Context(), userID)))
+	})
+}
+
+// sessionMiddleware lets storage read back the writes of the same request.
+func (s *Server) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(app.ContextWithSession(r.Context())))
+	})
+}
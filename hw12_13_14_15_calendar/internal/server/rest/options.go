@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/auth"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/certs"
+)
+
+type options struct {
+	// accessLogSampleEvery logs one of n successful fast requests, errors and slow requests are always logged
+	accessLogSampleEvery uint64
+	slowRequest          time.Duration
+	rateLimit            float64
+	rateBurst            int
+	maxBodySize          int64
+	requestTimeout       time.Duration
+	authenticator        *auth.Authenticator
+	certs                *certs.Reloader
+	gatewayPrefix        string
+	gateway              http.Handler
+}
+
+func defaultOptions() options {
+	return options{requestTimeout: defaultRequestTimeout}
+}
+
+type Option func(*options)
+
+// WithAccessLogSampling logs every n-th successful request, n <= 1 logs all of them.
+func WithAccessLogSampling(n int) Option {
+	return func(o *options) {
+		if n > 1 {
+			o.accessLogSampleEvery = uint64(n)
+		}
+	}
+}
+
+// WithSlowRequestThreshold logs requests lasting longer than d at warn level, zero disables it.
+func WithSlowRequestThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slowRequest = d
+	}
+}
+
+// WithRateLimit allows every client rate requests per second with bursts up to burst, zero rate disables it.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = rate
+		o.rateBurst = burst
+	}
+}
+
+// WithMaxBodySize rejects request bodies larger than n bytes, zero keeps bodies unlimited.
+func WithMaxBodySize(n int64) Option {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// WithRequestTimeout sets the deadline of not streaming requests, zero keeps the default.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.requestTimeout = d
+		}
+	}
+}
+
+// WithAuthenticator requires a bearer jwt or an api key from every api call, nil keeps the api open.
+func WithAuthenticator(a *auth.Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = a
+	}
+}
+
+// WithTLS serves over tls with certificates of r, nil r keeps plain connections.
+func WithTLS(r *certs.Reloader) Option {
+	return func(o *options) {
+		o.certs = r
+	}
+}
+
+// WithGateway serves requests under prefix by h behind the same middlewares as the routes of the api.
+func WithGateway(prefix string, h http.Handler) Option {
+	return func(o *options) {
+		o.gatewayPrefix = prefix
+		o.gateway = h
+	}
+}
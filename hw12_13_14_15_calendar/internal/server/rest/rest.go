@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 )
 
 var statusCtxKey = NewContextKey("Status")
@@ -37,6 +39,10 @@ func sendErrorJSON(w http.ResponseWriter, r *http.Request, httpStatusCode int, e
 		Data:  nil,
 		Error: JSON{"message": e.Error()},
 	}
+	// code lets clients tell domain errors apart without parsing the message
+	if code := app.CodeOf(err); code != "" {
+		resp.Error["code"] = code
+	}
 	status(r, httpStatusCode)
 	sendJSON(w, r, resp)
 }
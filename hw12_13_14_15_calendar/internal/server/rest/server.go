@@ -10,6 +10,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/limiter"
 )
 
 type ServerError struct {
@@ -19,7 +20,7 @@ type ServerError struct {
 
 func (e *ServerError) Error() string {
 	if e.Err != nil {
-		e.Message = e.Message + " --> " + e.Err.Error()
+		return e.Message + " --> " + e.Err.Error()
 	}
 	return e.Message
 }
@@ -27,8 +28,9 @@ func (e *ServerError) Unwrap() error {
 	return e.Err
 }
 
+// Application is checked by the readiness probe.
 type Application interface {
-	// TODO
+	Ping(ctx context.Context) error
 }
 
 type ServerAPI interface {
@@ -40,31 +42,52 @@ type Route struct {
 	Method string
 	Path   string
 	Func   http.HandlerFunc
+	Stream bool
 }
 
+const defaultRequestTimeout = 10 * time.Second
+
 type Server struct {
-	Address string
-	public  ServerAPI
-	server  *http.Server
-	log     app.Logger
+	// requests counts successful requests for access log sampling, it's first for 64-bit alignment of atomics
+	requests uint64
+	Address  string
+	public   ServerAPI
+	app      Application
+	server   *http.Server
+	log      app.Logger
+	opts     options
+	limiter  *limiter.Limiter
 }
 
-func NewServer(public ServerAPI, host, port string, logger app.Logger) *Server {
-	return &Server{
+func NewServer(public ServerAPI, application Application, host, port string, logger app.Logger, opts ...Option) *Server {
+	s := &Server{
 		Address: net.JoinHostPort(host, port),
 		public:  public,
+		app:     application,
 		log:     logger,
 	}
+	s.opts = defaultOptions()
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.limiter = limiter.New(s.opts.rateLimit, s.opts.rateBurst)
+	return s
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	s.server = &http.Server{ // nolint: exhaustivestruct
-		Addr:         s.Address,
-		Handler:      s.router(),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:        s.Address,
+		Handler:     s.router(),
+		ReadTimeout: 5 * time.Second,
+	}
+	var err error
+	if s.opts.certs != nil {
+		s.server.TLSConfig = s.opts.certs.Config("h2", "http/1.1")
+		// certificates come from TLSConfig, so they are picked up again on reload
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
 	}
-	err := s.server.ListenAndServe()
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return &ServerError{Message: "start server error", Err: err}
 	}
@@ -85,13 +108,39 @@ func (s *Server) Stop(ctx context.Context) error {
 
 func (s *Server) router() *mux.Router {
 	router := mux.NewRouter()
+	// probes are called every few seconds, they are kept out of the access log
+	router.Methods(http.MethodGet).Path("/healthz").Name("Healthz").HandlerFunc(s.healthz)
+	router.Methods(http.MethodGet).Path("/readyz").Name("Readyz").HandlerFunc(s.readyz)
 	for _, route := range s.public.Routes() {
-		handler := alice.New(s.loggingMiddleware).ThenFunc(route.Func)
+		var handler http.Handler = route.Func
+		if !route.Stream {
+			// write timeout is applied per route, streaming responses live as long as the client is connected
+			handler = http.TimeoutHandler(handler, s.opts.requestTimeout, "request timeout")
+		}
 		router.
 			Methods(route.Method).
 			Path(route.Path).
 			Name(route.Name).
-			Handler(handler)
+			Handler(s.middlewares().Then(handler))
+	}
+	if s.opts.gateway != nil {
+		router.
+			PathPrefix(s.opts.gatewayPrefix).
+			Name("Gateway").
+			Handler(s.middlewares().Then(http.TimeoutHandler(s.opts.gateway, s.opts.requestTimeout, "request timeout")))
 	}
 	return router
 }
+
+func (s *Server) middlewares() alice.Chain {
+	return alice.New(
+		s.tracingMiddleware,
+		s.requestIDMiddleware,
+		s.loggingMiddleware,
+		s.recoveryMiddleware,
+		s.rateLimitMiddleware,
+		s.bodyLimitMiddleware,
+		s.authMiddleware,
+		s.sessionMiddleware,
+	)
+}
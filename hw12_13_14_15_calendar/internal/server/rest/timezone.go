@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/server/errmap"
+)
+
+const timezoneHeader = "X-Timezone"
+
+var errNoActor = errors.New(actorHeader + " header is required")
+
+// EventForm accepts RFC 3339 start and end, they take precedence over the numeric start_date and end_date.
+type EventForm struct {
+	app.Event
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+func (f EventForm) event() app.Event {
+	e := f.Event
+	if f.Start != nil {
+		e.StartDate = f.Start.Unix()
+	}
+	if f.End != nil {
+		e.EndDate = f.End.Unix()
+	}
+	return e
+}
+
+// EventView keeps the numeric fields and adds start and end rendered in the zone of the caller,
+// all-day events are rendered as dates since they don't depend on the zone.
+type EventView struct {
+	app.Event
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func newEventViews(events []app.Event, loc *time.Location) []EventView {
+	views := make([]EventView, len(events))
+	for i, e := range events {
+		views[i] = EventView{Event: e, Start: e.StartDay, End: e.EndDay}
+		if !e.AllDay {
+			views[i].Start = time.Unix(e.StartDate, 0).In(loc).Format(time.RFC3339)
+			views[i].End = time.Unix(e.EndDate, 0).In(loc).Format(time.RFC3339)
+		}
+	}
+	return views
+}
+
+type UserTimezoneForm struct {
+	Timezone string `json:"timezone"`
+}
+
+// callerLocation resolves the zone to render times in: tz query param, X-Timezone header, saved user zone, UTC.
+func (a *API) callerLocation(r *http.Request, tz string) (*time.Location, error) {
+	if tz == "" {
+		tz = r.Header.Get(timezoneHeader)
+	}
+	if tz == "" {
+		return a.application.ActorLocation(r.Context()), nil
+	}
+	return app.LoadLocation(tz)
+}
+
+func (a *API) setUserTimezone(w http.ResponseWriter, r *http.Request) {
+	actor := app.ActorFromContext(r.Context())
+	if actor == "" {
+		sendErrorJSON(w, r, http.StatusBadRequest, errNoActor, "can't set user timezone")
+		return
+	}
+
+	var form UserTimezoneForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		sendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse")
+		return
+	}
+
+	if err := a.application.SetUserTimezone(r.Context(), actor, form.Timezone); err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't set user timezone")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, nil)
+}
+
+func (a *API) userTimezone(w http.ResponseWriter, r *http.Request) {
+	actor := app.ActorFromContext(r.Context())
+	if actor == "" {
+		sendErrorJSON(w, r, http.StatusBadRequest, errNoActor, "can't get user timezone")
+		return
+	}
+
+	tz, err := a.application.UserTimezone(r.Context(), actor)
+	if err != nil {
+		sendErrorJSON(w, r, errmap.HTTPStatus(err), err, "can't get user timezone")
+		return
+	}
+
+	sendDataJSON(w, r, http.StatusOK, UserTimezoneForm{Timezone: tz})
+}
@@ -0,0 +1,586 @@
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	eventsBucket     = []byte("events")
+	startIndex       = []byte("idx_start")
+	reminderIndex    = []byte("idx_remind")
+	durationIndex    = []byte("idx_duration")
+	historyBucket    = []byte("history")
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("deliveries")
+	timezonesBucket  = []byte("timezones")
+
+	errBulkRollback = errors.New("bulk is rolled back")
+)
+
+type BoltError struct {
+	app.BaseError
+}
+
+func NewError(msg string, err error) *BoltError {
+	return &BoltError{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+type EventDataStore struct {
+	db *bolt.DB
+}
+
+// New opens the db file exclusively, only one process can use it at a time.
+func New(path string) (*EventDataStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second}) // nolint: exhaustivestruct
+	if err != nil {
+		return nil, NewError("can't open db file", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			eventsBucket, startIndex, reminderIndex, durationIndex,
+			historyBucket, webhooksBucket, deliveriesBucket, timezonesBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fillDurationIndex(tx)
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, NewError("can't create buckets", err)
+	}
+
+	return &EventDataStore{db: db}, nil
+}
+
+func (s *EventDataStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping fails after Close as any read transaction does.
+func (s *EventDataStore) Ping(ctx context.Context) error {
+	return s.view(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
+	return s.update(func(tx *bolt.Tx) error {
+		current, err := getEvent(tx, e.ID)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			return storage.ErrEventAlreadyExist
+		}
+		return putEvent(tx, nil, e)
+	})
+}
+
+func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
+	return s.update(func(tx *bolt.Tx) error {
+		current, err := getEvent(tx, e.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return storage.ErrEventDoesNotExist
+		}
+		return putEvent(tx, current, e)
+	})
+}
+
+func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		current, err := getEvent(tx, id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return storage.ErrEventDoesNotExist
+		}
+		return deleteEvent(tx, *current)
+	})
+}
+
+func (s *EventDataStore) Event(ctx context.Context, id string) (app.Event, error) {
+	var event app.Event
+	err := s.view(func(tx *bolt.Tx) error {
+		current, err := getEvent(tx, id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return storage.ErrEventDoesNotExist
+		}
+		event = *current
+		return nil
+	})
+	if err != nil {
+		return app.Event{}, err
+	}
+	return event, nil
+}
+
+func (s *EventDataStore) EventListFilterByStartDate(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.eventList(func(tx *bolt.Tx, add func(id []byte) error) error {
+		return scanIndex(tx.Bucket(startIndex), from, to, add)
+	})
+}
+
+func (s *EventDataStore) EventListFilterByReminderIn(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.eventList(func(tx *bolt.Tx, add func(id []byte) error) error {
+		return scanIndex(tx.Bucket(reminderIndex), from, to, add)
+	})
+}
+
+func (s *EventDataStore) EventListFilterByPeriod(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.overlapping(from, to)
+}
+
+func (s *EventDataStore) BulkApply(ctx context.Context, ops []app.BulkOperation, atomic bool) ([]app.BulkResult, error) {
+	results := make([]app.BulkResult, len(ops))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		failed := false
+		for i, op := range ops {
+			results[i] = app.BulkResult{Index: i, EventID: op.Event.ID}
+			if failed && atomic {
+				results[i].Err = app.ErrBulkAborted
+				continue
+			}
+
+			before, err := applyOperation(tx, op)
+			var boltErr *BoltError
+			if errors.As(err, &boltErr) {
+				return err
+			}
+			results[i].Before, results[i].Err = before, err
+			failed = failed || err != nil
+		}
+
+		if failed && atomic {
+			for i := range results {
+				if results[i].Err == nil {
+					results[i].Err = app.ErrBulkAborted
+					results[i].Before = nil
+				}
+			}
+			return errBulkRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkRollback) {
+		return nil, NewError("can't apply operations", err)
+	}
+	return results, nil
+}
+
+func (s *EventDataStore) AddEventHistory(ctx context.Context, r app.EventHistoryRecord) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(r.EventID))
+		if err != nil {
+			return NewError("can't create history bucket", err)
+		}
+		return putSequenced(b, r)
+	})
+}
+
+func (s *EventDataStore) EventHistory(ctx context.Context, eventID string) ([]app.EventHistoryRecord, error) {
+	records := []app.EventHistoryRecord{}
+	err := s.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket).Bucket([]byte(eventID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r app.EventHistoryRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return NewError("can't unmarshal event history", err)
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *EventDataStore) NewWebhook(ctx context.Context, w app.Webhook) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(webhooksBucket)
+		if b.Get([]byte(w.ID)) != nil {
+			return storage.ErrWebhookAlreadyExist
+		}
+		return putJSON(b, []byte(w.ID), w)
+	})
+}
+
+func (s *EventDataStore) RemoveWebhook(ctx context.Context, id string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(webhooksBucket)
+		if b.Get([]byte(id)) == nil {
+			return storage.ErrWebhookDoesNotExist
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return NewError("can't delete webhook", err)
+		}
+		err := tx.Bucket(deliveriesBucket).DeleteBucket([]byte(id))
+		if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return NewError("can't delete webhook deliveries", err)
+		}
+		return nil
+	})
+}
+
+func (s *EventDataStore) Webhooks(ctx context.Context) ([]app.Webhook, error) {
+	webhooks := []app.Webhook{}
+	err := s.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(k, v []byte) error {
+			var w app.Webhook
+			if err := json.Unmarshal(v, &w); err != nil {
+				return NewError("can't unmarshal webhook", err)
+			}
+			webhooks = append(webhooks, w)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *EventDataStore) AddWebhookDelivery(ctx context.Context, d app.WebhookDelivery) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists([]byte(d.WebhookID))
+		if err != nil {
+			return NewError("can't create deliveries bucket", err)
+		}
+		return putSequenced(b, d)
+	})
+}
+
+func (s *EventDataStore) WebhookDeliveries(ctx context.Context, webhookID string) ([]app.WebhookDelivery, error) {
+	deliveries := []app.WebhookDelivery{}
+	err := s.view(func(tx *bolt.Tx) error {
+		if tx.Bucket(webhooksBucket).Get([]byte(webhookID)) == nil {
+			return storage.ErrWebhookDoesNotExist
+		}
+		b := tx.Bucket(deliveriesBucket).Bucket([]byte(webhookID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var d app.WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return NewError("can't unmarshal webhook delivery", err)
+			}
+			deliveries = append(deliveries, d)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *EventDataStore) SetUserTimezone(ctx context.Context, userID string, tz string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(timezonesBucket).Put([]byte(userID), []byte(tz)); err != nil {
+			return NewError("can't save user timezone", err)
+		}
+		return nil
+	})
+}
+
+func (s *EventDataStore) UserTimezone(ctx context.Context, userID string) (string, error) {
+	var tz string
+	err := s.view(func(tx *bolt.Tx) error {
+		tz = string(tx.Bucket(timezonesBucket).Get([]byte(userID)))
+		return nil
+	})
+	return tz, err
+}
+
+// update and view pass storage and app errors through as is and wrap errors of bolt itself.
+func (s *EventDataStore) update(fn func(tx *bolt.Tx) error) error {
+	return wrapError(s.db.Update(fn))
+}
+
+func (s *EventDataStore) view(fn func(tx *bolt.Tx) error) error {
+	return wrapError(s.db.View(fn))
+}
+
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		boltErr    *BoltError
+		storageErr *storage.Error
+		baseErr    *app.BaseError
+	)
+	if errors.As(err, &boltErr) || errors.As(err, &storageErr) || errors.As(err, &baseErr) {
+		return err
+	}
+	return NewError("db error", err)
+}
+
+func (s *EventDataStore) eventList(scan func(tx *bolt.Tx, add func(id []byte) error) error) ([]app.Event, error) {
+	var events []app.Event
+	err := s.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		return scan(tx, func(id []byte) error {
+			var e app.Event
+			if err := json.Unmarshal(b.Get(id), &e); err != nil {
+				return NewError("can't unmarshal event", err)
+			}
+			events = append(events, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, storage.ErrNoEvents
+	}
+	return events, nil
+}
+
+func (s *EventDataStore) overlapping(from, to int64) ([]app.Event, error) {
+	var events []app.Event
+	err := s.view(func(tx *bolt.Tx) error {
+		maxDuration := maxDuration(tx)
+		b := tx.Bucket(eventsBucket)
+
+		// start <= to AND last >= from, so start is in [from - maxDuration, to]
+		lower := from - maxDuration
+		if maxDuration == math.MaxInt64 || lower > from {
+			lower = math.MinInt64
+		}
+		return scanIndex(tx.Bucket(startIndex), lower, to, func(id []byte) error {
+			var e app.Event
+			if err := json.Unmarshal(b.Get(id), &e); err != nil {
+				return NewError("can't unmarshal event", err)
+			}
+			if e.Overlaps(from, to) {
+				events = append(events, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, storage.ErrNoEvents
+	}
+	return events, nil
+}
+
+func applyOperation(tx *bolt.Tx, op app.BulkOperation) (*app.Event, error) {
+	current, err := getEvent(tx, op.Event.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		if err := op.CheckOwner(*current); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Type {
+	case app.BulkCreate:
+		if current != nil {
+			return nil, storage.ErrEventAlreadyExist
+		}
+		return nil, putEvent(tx, nil, op.Event)
+	case app.BulkUpdate:
+		if current == nil {
+			return nil, storage.ErrEventDoesNotExist
+		}
+		return current, putEvent(tx, current, op.Event)
+	case app.BulkDelete:
+		if current == nil {
+			return nil, storage.ErrEventDoesNotExist
+		}
+		return current, deleteEvent(tx, *current)
+	default:
+		return nil, app.ErrBulkUnknownOperation
+	}
+}
+
+func getEvent(tx *bolt.Tx, id string) (*app.Event, error) {
+	data := tx.Bucket(eventsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	var e app.Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, NewError("can't unmarshal event", err)
+	}
+	return &e, nil
+}
+
+// putEvent saves the event and moves its index entries, current is the stored version or nil for a new event.
+func putEvent(tx *bolt.Tx, current *app.Event, e app.Event) error {
+	if current != nil {
+		if err := deleteIndexes(tx, *current); err != nil {
+			return err
+		}
+	}
+	if err := putJSON(tx.Bucket(eventsBucket), []byte(e.ID), e); err != nil {
+		return err
+	}
+
+	id := []byte(e.ID)
+	entries := []struct {
+		bucket []byte
+		key    []byte
+	}{
+		{startIndex, indexKey(e.StartDate, id)},
+		{reminderIndex, indexKey(e.RemindIn, id)},
+		{durationIndex, indexKey(duration(e), id)},
+	}
+	for _, entry := range entries {
+		if err := tx.Bucket(entry.bucket).Put(entry.key, id); err != nil {
+			return NewError("can't update index", err)
+		}
+	}
+	return nil
+}
+
+func deleteEvent(tx *bolt.Tx, e app.Event) error {
+	if err := deleteIndexes(tx, e); err != nil {
+		return err
+	}
+	if err := tx.Bucket(eventsBucket).Delete([]byte(e.ID)); err != nil {
+		return NewError("can't delete event", err)
+	}
+	return nil
+}
+
+func deleteIndexes(tx *bolt.Tx, e app.Event) error {
+	id := []byte(e.ID)
+	if err := tx.Bucket(startIndex).Delete(indexKey(e.StartDate, id)); err != nil {
+		return NewError("can't update index", err)
+	}
+	if err := tx.Bucket(reminderIndex).Delete(indexKey(e.RemindIn, id)); err != nil {
+		return NewError("can't update index", err)
+	}
+	if err := tx.Bucket(durationIndex).Delete(indexKey(duration(e), id)); err != nil {
+		return NewError("can't update index", err)
+	}
+	return nil
+}
+
+// duration is last - start, it's capped for events spanning more than math.MaxInt64 seconds,
+// the overlap query then scans the start index from the beginning.
+func duration(e app.Event) int64 {
+	start, last := e.Span()
+	if d := last - start; d >= 0 {
+		return d
+	}
+	return math.MaxInt64
+}
+
+// maxDuration is the duration of the longest stored event, overlap query scans start index from (from - maxDuration),
+// the duration index keeps it exact when long events are updated or removed.
+func maxDuration(tx *bolt.Tx) int64 {
+	k, _ := tx.Bucket(durationIndex).Cursor().Last()
+	if k == nil {
+		return 0
+	}
+	return decodeInt(k[:8])
+}
+
+// fillDurationIndex builds the index for files created before it, the overlap query can't go without it.
+func fillDurationIndex(tx *bolt.Tx) error {
+	if k, _ := tx.Bucket(durationIndex).Cursor().First(); k != nil {
+		return nil
+	}
+	return tx.Bucket(eventsBucket).ForEach(func(k, v []byte) error {
+		var e app.Event
+		if err := json.Unmarshal(v, &e); err != nil {
+			return NewError("can't unmarshal event", err)
+		}
+		if err := tx.Bucket(durationIndex).Put(indexKey(duration(e), k), k); err != nil {
+			return NewError("can't update index", err)
+		}
+		return nil
+	})
+}
+
+// scanIndex calls fn with ids of index entries with from <= key <= to in the order of keys.
+func scanIndex(b *bolt.Bucket, from, to int64, fn func(id []byte) error) error {
+	if from > to {
+		return nil
+	}
+	c := b.Cursor()
+	upper := indexKey(to, nil)
+	for k, id := c.Seek(indexKey(from, nil)); k != nil; k, id = c.Next() {
+		if bytes.Compare(k[:len(upper)], upper) > 0 {
+			return nil
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKey is sortable big endian key + id, so entries with equal keys are ordered by id.
+func indexKey(key int64, id []byte) []byte {
+	return append(encodeInt(key), id...)
+}
+
+// encodeInt flips the sign bit, so negative values go before positive ones in byte order.
+func encodeInt(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v)^(1<<63))
+	return b
+}
+
+func decodeInt(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return NewError("can't marshal value", err)
+	}
+	if err := b.Put(key, data); err != nil {
+		return NewError("can't save value", err)
+	}
+	return nil
+}
+
+func putSequenced(b *bolt.Bucket, v interface{}) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return NewError("can't get next sequence", err)
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return putJSON(b, key, v)
+}
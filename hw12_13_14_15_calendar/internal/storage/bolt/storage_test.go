@@ -0,0 +1,105 @@
+package boltstorage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStoreSuite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var stores []*EventDataStore
+	defer func() {
+		for _, s := range stores {
+			_ = s.Close()
+		}
+	}()
+
+	suite.Run(t, &storagetest.Suite{NewStorage: func() app.Storage {
+		s, err := New(filepath.Join(dir, fmt.Sprintf("calendar_%d.db", len(stores))))
+		require.NoError(t, err)
+		stores = append(stores, s)
+		return s
+	}})
+}
+
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "calendar.db")
+
+	s, err := New(path)
+	require.NoError(t, err)
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "1", OwnerID: "owner_1", StartDate: -100, EndDate: 1000, RemindIn: -200}))
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "2", OwnerID: "owner_2", StartDate: 500, EndDate: 600, RemindIn: 400}))
+	require.NoError(t, s.Ping(ctx))
+	require.NoError(t, s.Close())
+	require.Error(t, s.Ping(ctx))
+
+	s, err = New(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	list, err := s.EventListFilterByPeriod(ctx, 700, 800)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "1", list[0].ID)
+
+	list, err = s.EventListFilterByReminderIn(ctx, -300, 0)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "1", list[0].ID)
+
+	list, err = s.EventListFilterByStartDate(ctx, 0, 1000)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "2", list[0].ID)
+}
+
+func TestMaxDurationFollowsEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	s, err := New(filepath.Join(dir, "calendar.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// durations are last - start of the closed span
+	maxDuration := func() (d int64) {
+		require.NoError(t, s.view(func(tx *bolt.Tx) error {
+			d = maxDuration(tx)
+			return nil
+		}))
+		return d
+	}
+
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "1", StartDate: 0, EndDate: 1000}))
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "2", StartDate: 0, EndDate: 10}))
+	require.Equal(t, int64(999), maxDuration())
+
+	require.NoError(t, s.UpdateEvent(ctx, app.Event{ID: "1", StartDate: 0, EndDate: 100}))
+	require.Equal(t, int64(99), maxDuration())
+
+	require.NoError(t, s.RemoveEvent(ctx, "1"))
+	require.Equal(t, int64(9), maxDuration())
+
+	require.NoError(t, s.RemoveEvent(ctx, "2"))
+	require.Equal(t, int64(0), maxDuration())
+}
@@ -0,0 +1,80 @@
+package cachestorage
+
+import (
+	"container/list"
+	"time"
+)
+
+// lruCache is hw04 cache with entries expiring after ttl, it is not safe for concurrent use.
+type lruCache struct {
+	capacity int
+	ttl      time.Duration
+	queue    *list.List
+	items    map[queryKey]*list.Element
+}
+
+type cacheItem struct {
+	key       queryKey
+	value     queryResult
+	expiresAt time.Time
+}
+
+func newLRUCache(capacity int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		queue:    list.New(),
+		items:    make(map[queryKey]*list.Element),
+	}
+}
+
+func (c *lruCache) Set(key queryKey, value queryResult, now time.Time) {
+	item := cacheItem{key: key, value: value, expiresAt: now.Add(c.ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = item
+		c.queue.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.queue.PushFront(item)
+	if c.queue.Len() > c.capacity {
+		c.remove(c.queue.Back())
+	}
+}
+
+func (c *lruCache) Get(key queryKey, now time.Time) (queryResult, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return queryResult{}, false
+	}
+	item := el.Value.(cacheItem)
+	if !now.Before(item.expiresAt) {
+		c.remove(el)
+		return queryResult{}, false
+	}
+	c.queue.MoveToFront(el)
+	return item.value, true
+}
+
+// RemoveFunc removes every entry with matching key.
+func (c *lruCache) RemoveFunc(match func(key queryKey) bool) {
+	for key, el := range c.items {
+		if match(key) {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *lruCache) Clear() {
+	c.queue.Init()
+	c.items = make(map[queryKey]*list.Element)
+}
+
+func (c *lruCache) Len() int {
+	return c.queue.Len()
+}
+
+func (c *lruCache) remove(el *list.Element) {
+	c.queue.Remove(el)
+	delete(c.items, el.Value.(cacheItem).key)
+}
@@ -0,0 +1,63 @@
+package cachestorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	key := func(from int64) queryKey {
+		return queryKey{kind: byPeriod, from: from, to: from + 1}
+	}
+	value := func(id string) queryResult {
+		return queryResult{events: []app.Event{{ID: id}}}
+	}
+
+	t.Run("purge logic", func(t *testing.T) {
+		c := newLRUCache(3, time.Minute)
+		c.Set(key(1), value("1"), now)
+		c.Set(key(2), value("2"), now)
+		c.Set(key(3), value("3"), now)
+
+		_, ok := c.Get(key(1), now)
+		require.True(t, ok)
+		c.Set(key(2), value("22"), now)
+		c.Set(key(4), value("4"), now)
+
+		_, ok = c.Get(key(3), now)
+		require.False(t, ok)
+		v, ok := c.Get(key(2), now)
+		require.True(t, ok)
+		require.Equal(t, value("22"), v)
+		require.Equal(t, 3, c.Len())
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		c := newLRUCache(3, time.Minute)
+		c.Set(key(1), value("1"), now)
+
+		_, ok := c.Get(key(1), now.Add(time.Minute-time.Nanosecond))
+		require.True(t, ok)
+		_, ok = c.Get(key(1), now.Add(time.Minute))
+		require.False(t, ok)
+		require.Equal(t, 0, c.Len())
+	})
+
+	t.Run("remove func and clear", func(t *testing.T) {
+		c := newLRUCache(3, time.Minute)
+		c.Set(key(1), value("1"), now)
+		c.Set(key(2), value("2"), now)
+
+		c.RemoveFunc(func(k queryKey) bool { return k.from == 1 })
+		_, ok := c.Get(key(1), now)
+		require.False(t, ok)
+		require.Equal(t, 1, c.Len())
+
+		c.Clear()
+		require.Equal(t, 0, c.Len())
+	})
+}
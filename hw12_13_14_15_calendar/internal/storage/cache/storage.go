@@ -0,0 +1,278 @@
+package cachestorage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+)
+
+type queryKind uint8
+
+const (
+	byStartDate queryKind = iota
+	byPeriod
+	byReminderIn
+)
+
+type queryKey struct {
+	kind queryKind
+	from int64
+	to   int64
+}
+
+// match tells whether the event is a part of the query result.
+func (k queryKey) match(e app.Event) bool {
+	switch k.kind {
+	case byStartDate:
+		return e.StartDate >= k.from && e.StartDate <= k.to
+	case byReminderIn:
+		return e.RemindIn >= k.from && e.RemindIn <= k.to
+	case byPeriod:
+		return e.Overlaps(k.from, k.to)
+	default:
+		return true
+	}
+}
+
+// queryResult keeps ErrNoEvents too, empty ranges are asked as often as filled ones.
+type queryResult struct {
+	events []app.Event
+	err    error
+}
+
+// ChangeSource reports event changes committed by any process, before and after are both nil
+// when changes may have been missed.
+type ChangeSource interface {
+	ListenChanges(ctx context.Context, fn func(before, after *app.Event))
+}
+
+// EventDataStore caches event range queries of the wrapped storage,
+// writes through it drop the cached ranges which contain the old or the new event.
+// Writes of other processes are seen only via Changed, without a ChangeSource behind it
+// the cache is correct only when this process is the single writer of the storage.
+// Every storage method is implemented explicitly, so a new mutator can't skip invalidation.
+type EventDataStore struct {
+	storage app.Storage
+	stats   storage.CacheStats
+	mu      sync.Mutex
+	cache   *lruCache
+	// gen is changed by every invalidation, a result loaded across it may be stale and is not cached
+	gen uint64
+	now func() time.Time
+}
+
+func New(s app.Storage, capacity int, ttl time.Duration) *EventDataStore {
+	return &EventDataStore{
+		storage: s,
+		cache:   newLRUCache(capacity, ttl),
+		now:     time.Now,
+	}
+}
+
+func (s *EventDataStore) Stats() storage.CacheStats {
+	return storage.CacheStats{
+		Hits:   atomic.LoadInt64(&s.stats.Hits),
+		Misses: atomic.LoadInt64(&s.stats.Misses),
+	}
+}
+
+// Ping passes through to the wrapped storage, the cache itself is always healthy.
+func (s *EventDataStore) Ping(ctx context.Context) error {
+	if p, ok := s.storage.(app.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Changed drops the ranges of an event changed elsewhere, it's the callback for ChangeSource.
+func (s *EventDataStore) Changed(before, after *app.Event) {
+	var changed []app.Event
+	for _, e := range []*app.Event{before, after} {
+		if e != nil {
+			changed = append(changed, *e)
+		}
+	}
+	if len(changed) == 0 {
+		s.clear()
+		return
+	}
+	s.invalidate(changed...)
+}
+
+func (s *EventDataStore) Event(ctx context.Context, id string) (app.Event, error) {
+	return s.storage.Event(ctx, id)
+}
+
+func (s *EventDataStore) EventListFilterByStartDate(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.cached(queryKey{kind: byStartDate, from: from, to: to}, func() ([]app.Event, error) {
+		return s.storage.EventListFilterByStartDate(ctx, from, to)
+	})
+}
+
+func (s *EventDataStore) EventListFilterByPeriod(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.cached(queryKey{kind: byPeriod, from: from, to: to}, func() ([]app.Event, error) {
+		return s.storage.EventListFilterByPeriod(ctx, from, to)
+	})
+}
+
+func (s *EventDataStore) EventListFilterByReminderIn(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.cached(queryKey{kind: byReminderIn, from: from, to: to}, func() ([]app.Event, error) {
+		return s.storage.EventListFilterByReminderIn(ctx, from, to)
+	})
+}
+
+func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
+	err := s.storage.NewEvent(ctx, e)
+	if err == nil {
+		s.invalidate(e)
+	}
+	return err
+}
+
+func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
+	old, oldErr := s.storage.Event(ctx, e.ID)
+	err := s.storage.UpdateEvent(ctx, e)
+	if err != nil {
+		return err
+	}
+	if oldErr != nil {
+		s.clear()
+		return nil
+	}
+	s.invalidate(old, e)
+	return nil
+}
+
+func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) error {
+	old, oldErr := s.storage.Event(ctx, id)
+	err := s.storage.RemoveEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if oldErr != nil {
+		s.clear()
+		return nil
+	}
+	s.invalidate(old)
+	return nil
+}
+
+func (s *EventDataStore) BulkApply(ctx context.Context, ops []app.BulkOperation, atomic bool) ([]app.BulkResult, error) {
+	results, err := s.storage.BulkApply(ctx, ops, atomic)
+	if err != nil {
+		// the batch may be partially applied before the failure
+		s.clear()
+		return results, err
+	}
+
+	var changed []app.Event
+	for i, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if r.Before != nil {
+			changed = append(changed, *r.Before)
+		}
+		if ops[i].Type != app.BulkDelete {
+			changed = append(changed, ops[i].Event)
+		}
+	}
+	s.invalidate(changed...)
+	return results, nil
+}
+
+func (s *EventDataStore) AddEventHistory(ctx context.Context, r app.EventHistoryRecord) error {
+	return s.storage.AddEventHistory(ctx, r)
+}
+
+func (s *EventDataStore) EventHistory(ctx context.Context, eventID string) ([]app.EventHistoryRecord, error) {
+	return s.storage.EventHistory(ctx, eventID)
+}
+
+func (s *EventDataStore) NewWebhook(ctx context.Context, w app.Webhook) error {
+	return s.storage.NewWebhook(ctx, w)
+}
+
+func (s *EventDataStore) RemoveWebhook(ctx context.Context, id string) error {
+	return s.storage.RemoveWebhook(ctx, id)
+}
+
+func (s *EventDataStore) Webhooks(ctx context.Context) ([]app.Webhook, error) {
+	return s.storage.Webhooks(ctx)
+}
+
+func (s *EventDataStore) AddWebhookDelivery(ctx context.Context, d app.WebhookDelivery) error {
+	return s.storage.AddWebhookDelivery(ctx, d)
+}
+
+func (s *EventDataStore) WebhookDeliveries(ctx context.Context, webhookID string) ([]app.WebhookDelivery, error) {
+	return s.storage.WebhookDeliveries(ctx, webhookID)
+}
+
+func (s *EventDataStore) SetUserTimezone(ctx context.Context, userID string, tz string) error {
+	return s.storage.SetUserTimezone(ctx, userID, tz)
+}
+
+func (s *EventDataStore) UserTimezone(ctx context.Context, userID string) (string, error) {
+	return s.storage.UserTimezone(ctx, userID)
+}
+
+func (s *EventDataStore) cached(key queryKey, load func() ([]app.Event, error)) ([]app.Event, error) {
+	s.mu.Lock()
+	res, ok := s.cache.Get(key, s.now())
+	gen := s.gen
+	s.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&s.stats.Hits, 1)
+		return copyEvents(res.events), res.err
+	}
+	atomic.AddInt64(&s.stats.Misses, 1)
+
+	events, err := load()
+	if err != nil && !errors.Is(err, storage.ErrNoEvents) {
+		return events, err
+	}
+
+	s.mu.Lock()
+	if gen == s.gen {
+		s.cache.Set(key, queryResult{events: copyEvents(events), err: err}, s.now())
+	}
+	s.mu.Unlock()
+	return events, err
+}
+
+func (s *EventDataStore) invalidate(events ...app.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	s.cache.RemoveFunc(func(key queryKey) bool {
+		for _, e := range events {
+			if key.match(e) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (s *EventDataStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	s.cache.Clear()
+}
+
+// copyEvents keeps the cached slices away from callers which may modify the result.
+func copyEvents(events []app.Event) []app.Event {
+	if events == nil {
+		return nil
+	}
+	return append(make([]app.Event, 0, len(events)), events...)
+}
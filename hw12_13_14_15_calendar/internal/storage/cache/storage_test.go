@@ -0,0 +1,128 @@
+package cachestorage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestStoreSuite(t *testing.T) {
+	suite.Run(t, &storagetest.Suite{NewStorage: func() app.Storage {
+		return New(memorystorage.New(), 100, time.Minute)
+	}})
+}
+
+func TestCacheHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 100, time.Minute)
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "1", OwnerID: "owner", StartDate: 10, EndDate: 20, RemindIn: 5}))
+	require.NoError(t, s.NewEvent(ctx, app.Event{ID: "2", OwnerID: "owner", StartDate: 100, EndDate: 200}))
+
+	list, err := s.EventListFilterByPeriod(ctx, 0, 50)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	list[0].Title = "changed by caller"
+
+	list, err = s.EventListFilterByPeriod(ctx, 0, 50)
+	require.NoError(t, err)
+	require.Equal(t, "", list[0].Title)
+	_, err = s.EventListFilterByPeriod(ctx, 300, 400)
+	require.True(t, errors.Is(err, storage.ErrNoEvents))
+	_, err = s.EventListFilterByPeriod(ctx, 300, 400)
+	require.True(t, errors.Is(err, storage.ErrNoEvents))
+	_, err = s.EventListFilterByStartDate(ctx, 100, 160)
+	require.NoError(t, err)
+	require.Equal(t, storage.CacheStats{Hits: 2, Misses: 3}, s.Stats())
+
+	t.Run("update moves event out of cached range", func(t *testing.T) {
+		require.NoError(t, s.UpdateEvent(ctx, app.Event{ID: "1", OwnerID: "owner", StartDate: 310, EndDate: 320}))
+
+		_, err := s.EventListFilterByPeriod(ctx, 0, 50)
+		require.True(t, errors.Is(err, storage.ErrNoEvents))
+		list, err := s.EventListFilterByPeriod(ctx, 300, 400)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		// start date range does not contain neither old nor new event
+		_, err = s.EventListFilterByStartDate(ctx, 100, 160)
+		require.NoError(t, err)
+		require.Equal(t, storage.CacheStats{Hits: 3, Misses: 5}, s.Stats())
+	})
+
+	t.Run("remove and create", func(t *testing.T) {
+		require.NoError(t, s.RemoveEvent(ctx, "1"))
+		_, err := s.EventListFilterByPeriod(ctx, 300, 400)
+		require.True(t, errors.Is(err, storage.ErrNoEvents))
+
+		require.NoError(t, s.NewEvent(ctx, app.Event{ID: "3", StartDate: 350, EndDate: 360}))
+		list, err := s.EventListFilterByPeriod(ctx, 300, 400)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		require.Equal(t, "3", list[0].ID)
+	})
+
+	t.Run("bulk", func(t *testing.T) {
+		_, err := s.BulkApply(ctx, []app.BulkOperation{
+			{Type: app.BulkDelete, Event: app.Event{ID: "3"}},
+			{Type: app.BulkCreate, Event: app.Event{ID: "4", StartDate: 20, EndDate: 30}},
+		}, true)
+		require.NoError(t, err)
+
+		_, err = s.EventListFilterByPeriod(ctx, 300, 400)
+		require.True(t, errors.Is(err, storage.ErrNoEvents))
+		list, err := s.EventListFilterByPeriod(ctx, 0, 50)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		require.Equal(t, "4", list[0].ID)
+	})
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	s := New(memorystorage.New(), 100, time.Minute)
+	s.now = func() time.Time { return now }
+
+	_, err := s.EventListFilterByStartDate(ctx, 0, 50)
+	require.True(t, errors.Is(err, storage.ErrNoEvents))
+	_, _ = s.EventListFilterByStartDate(ctx, 0, 50)
+	now = now.Add(time.Minute)
+	_, _ = s.EventListFilterByStartDate(ctx, 0, 50)
+	require.Equal(t, storage.CacheStats{Hits: 1, Misses: 2}, s.Stats())
+}
+
+func TestCacheChangedElsewhere(t *testing.T) {
+	ctx := context.Background()
+	base := memorystorage.New()
+	s := New(base, 100, time.Minute)
+	event := app.Event{ID: "1", StartDate: 10, EndDate: 20}
+	require.NoError(t, s.NewEvent(ctx, event))
+
+	list, err := s.EventListFilterByPeriod(ctx, 0, 50)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	// another process removes the event, the cache doesn't see it until it is told
+	require.NoError(t, base.RemoveEvent(ctx, event.ID))
+	list, err = s.EventListFilterByPeriod(ctx, 0, 50)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	s.Changed(&event, nil)
+	_, err = s.EventListFilterByPeriod(ctx, 0, 50)
+	require.True(t, errors.Is(err, storage.ErrNoEvents))
+
+	require.NoError(t, base.NewEvent(ctx, app.Event{ID: "2", StartDate: 30, EndDate: 40}))
+	s.Changed(nil, nil)
+	list, err = s.EventListFilterByPeriod(ctx, 0, 50)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "2", list[0].ID)
+}
@@ -0,0 +1,24 @@
+package memorystorage
+
+// sortedIndex orders events by a single point key, every key is stored as interval [key, key]
+// of the interval tree, so the range lookup is the same O(log n + k) overlap query.
+type sortedIndex struct {
+	tree *intervalTree
+}
+
+func newSortedIndex() *sortedIndex {
+	return &sortedIndex{tree: newIntervalTree()}
+}
+
+func (i *sortedIndex) Insert(id string, key int64) {
+	i.tree.Insert(id, key, key)
+}
+
+func (i *sortedIndex) Delete(id string, key int64) {
+	i.tree.Delete(id, key)
+}
+
+// Range calls fn for every id with from <= key <= to in the order of keys.
+func (i *sortedIndex) Range(from, to int64, fn func(id string)) {
+	i.tree.Overlapping(from, to, fn)
+}
@@ -0,0 +1,148 @@
+package memorystorage
+
+// intervalTree is a treap of closed intervals [start, last] ordered by (start, id) where every node
+// keeps the max last of its subtree, so the overlap query skips subtrees which end before the window.
+// Closed bounds let intervals and windows reach math.MaxInt64 without overflow.
+type intervalTree struct {
+	root *intervalNode
+	seed uint64
+}
+
+type intervalNode struct {
+	id       string
+	start    int64
+	last     int64
+	maxLast  int64
+	priority uint64
+	left     *intervalNode
+	right    *intervalNode
+}
+
+func newIntervalTree() *intervalTree {
+	return &intervalTree{seed: 0x9e3779b97f4a7c15}
+}
+
+func (t *intervalTree) Insert(id string, start, last int64) {
+	t.root = t.insert(t.root, &intervalNode{id: id, start: start, last: last, maxLast: last, priority: t.nextPriority()})
+}
+
+func (t *intervalTree) Delete(id string, start int64) {
+	t.root = t.delete(t.root, id, start)
+}
+
+// Overlapping calls fn for every interval with start <= to and last >= from in the order of start.
+func (t *intervalTree) Overlapping(from, to int64, fn func(id string)) {
+	if from > to {
+		return
+	}
+	overlapping(t.root, from, to, fn)
+}
+
+func (t *intervalTree) nextPriority() uint64 {
+	// xorshift is enough to keep the treap balanced, no need in crypto or global math/rand lock
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 7
+	t.seed ^= t.seed << 17
+	return t.seed
+}
+
+func (t *intervalTree) insert(n, nn *intervalNode) *intervalNode {
+	if n == nil {
+		return nn
+	}
+	if less(nn.start, nn.id, n.start, n.id) {
+		n.left = t.insert(n.left, nn)
+		if n.left.priority > n.priority {
+			n = rotateRight(n)
+		}
+	} else {
+		n.right = t.insert(n.right, nn)
+		if n.right.priority > n.priority {
+			n = rotateLeft(n)
+		}
+	}
+	n.update()
+	return n
+}
+
+func (t *intervalTree) delete(n *intervalNode, id string, start int64) *intervalNode {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case n.id == id && n.start == start:
+		return merge(n.left, n.right)
+	case less(start, id, n.start, n.id):
+		n.left = t.delete(n.left, id, start)
+	default:
+		n.right = t.delete(n.right, id, start)
+	}
+	n.update()
+	return n
+}
+
+func overlapping(n *intervalNode, from, to int64, fn func(id string)) {
+	if n == nil || n.maxLast < from {
+		return
+	}
+	overlapping(n.left, from, to, fn)
+	if n.start > to {
+		return
+	}
+	if n.last >= from {
+		fn(n.id)
+	}
+	overlapping(n.right, from, to, fn)
+}
+
+func merge(l, r *intervalNode) *intervalNode {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.priority > r.priority:
+		l.right = merge(l.right, r)
+		l.update()
+		return l
+	default:
+		r.left = merge(l, r.left)
+		r.update()
+		return r
+	}
+}
+
+func rotateRight(n *intervalNode) *intervalNode {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	n.update()
+	l.update()
+	return l
+}
+
+func rotateLeft(n *intervalNode) *intervalNode {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	n.update()
+	r.update()
+	return r
+}
+
+func (n *intervalNode) update() {
+	n.maxLast = n.last
+	if n.left != nil && n.left.maxLast > n.maxLast {
+		n.maxLast = n.left.maxLast
+	}
+	if n.right != nil && n.right.maxLast > n.maxLast {
+		n.maxLast = n.right.maxLast
+	}
+}
+
+func less(start1 int64, id1 string, start2 int64, id2 string) bool {
+	if start1 != start2 {
+		return start1 < start2
+	}
+	return id1 < id2
+}
@@ -0,0 +1,56 @@
+package memorystorage
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalTreeOverlapping(t *testing.T) {
+	type interval struct {
+		start, last int64
+	}
+	rnd := rand.New(rand.NewSource(1))
+	tree := newIntervalTree()
+	intervals := make(map[string]interval)
+
+	for i := 0; i < 2000; i++ {
+		id := strconv.Itoa(i)
+		start := rnd.Int63n(10000)
+		iv := interval{start: start, last: start + rnd.Int63n(500)}
+		intervals[id] = iv
+		tree.Insert(id, iv.start, iv.last)
+	}
+	for i := 0; i < 1000; i += 3 {
+		id := strconv.Itoa(i)
+		tree.Delete(id, intervals[id].start)
+		delete(intervals, id)
+	}
+
+	for i := 0; i < 100; i++ {
+		from := rnd.Int63n(11000) - 500
+		to := from + rnd.Int63n(1000)
+
+		var expected []string
+		for id, iv := range intervals {
+			if iv.start <= to && iv.last >= from {
+				expected = append(expected, id)
+			}
+		}
+
+		var got []string
+		prev := int64(-1)
+		tree.Overlapping(from, to, func(id string) {
+			require.GreaterOrEqual(t, intervals[id].start, prev)
+			prev = intervals[id].start
+			got = append(got, id)
+		})
+
+		sort.Strings(expected)
+		sort.Strings(got)
+		require.Equal(t, expected, got)
+	}
+}
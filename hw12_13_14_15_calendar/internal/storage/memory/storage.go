@@ -9,13 +9,27 @@ import (
 )
 
 type EventDataStore struct {
-	mu     sync.RWMutex
-	events map[string]*app.Event
+	mu         sync.RWMutex
+	events     map[string]*app.Event
+	history    map[string][]app.EventHistoryRecord
+	webhooks   map[string]*app.Webhook
+	deliveries map[string][]app.WebhookDelivery
+	timezones  map[string]string
+	periods    *intervalTree
+	starts     *sortedIndex
+	reminders  *sortedIndex
 }
 
 func New() *EventDataStore {
 	return &EventDataStore{
-		events: make(map[string]*app.Event),
+		events:     make(map[string]*app.Event),
+		history:    make(map[string][]app.EventHistoryRecord),
+		webhooks:   make(map[string]*app.Webhook),
+		deliveries: make(map[string][]app.WebhookDelivery),
+		timezones:  make(map[string]string),
+		periods:    newIntervalTree(),
+		starts:     newSortedIndex(),
+		reminders:  newSortedIndex(),
 	}
 }
 
@@ -27,7 +41,7 @@ func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
 		return storage.ErrEventAlreadyExist
 	}
 
-	s.events[e.ID] = &e
+	s.putEvent(&e)
 	return nil
 }
 
@@ -39,7 +53,7 @@ func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
 		return storage.ErrEventDoesNotExist
 	}
 
-	s.events[e.ID] = &e
+	s.putEvent(&e)
 	return nil
 }
 
@@ -51,20 +65,44 @@ func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) error {
 		return storage.ErrEventDoesNotExist
 	}
 
-	delete(s.events, id)
+	s.deleteEvent(id)
 	return nil
 }
 
+func (s *EventDataStore) Event(ctx context.Context, id string) (app.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.events[id]
+	if e == nil {
+		return app.Event{}, storage.ErrEventDoesNotExist
+	}
+	return *e, nil
+}
+
 func (s *EventDataStore) EventListFilterByStartDate(ctx context.Context, from int64, to int64) ([]app.Event, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var events []app.Event
 
-	for _, e := range s.events {
-		if e.StartDate >= from && e.StartDate <= to {
-			events = append(events, *e)
-		}
+	s.starts.Range(from, to, func(id string) {
+		events = append(events, *s.events[id])
+	})
+
+	if len(events) == 0 {
+		return nil, storage.ErrNoEvents
 	}
+	return events, nil
+}
+
+func (s *EventDataStore) EventListFilterByPeriod(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []app.Event
+
+	s.periods.Overlapping(from, to, func(id string) {
+		events = append(events, *s.events[id])
+	})
 
 	if len(events) == 0 {
 		return nil, storage.ErrNoEvents
@@ -77,14 +115,200 @@ func (s *EventDataStore) EventListFilterByReminderIn(ctx context.Context, from i
 	defer s.mu.RUnlock()
 	var events []app.Event
 
-	for _, e := range s.events {
-		if e.RemindIn >= from && e.RemindIn <= to {
-			events = append(events, *e)
-		}
-	}
+	s.reminders.Range(from, to, func(id string) {
+		events = append(events, *s.events[id])
+	})
 
 	if len(events) == 0 {
 		return nil, storage.ErrNoEvents
 	}
 	return events, nil
 }
+
+func (s *EventDataStore) BulkApply(ctx context.Context, ops []app.BulkOperation, atomic bool) ([]app.BulkResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// changes are staged first, so all-or-nothing batch can be dropped without touching the store,
+	// nil value in staged map means that the event is removed
+	staged := make(map[string]*app.Event)
+	lookup := func(id string) *app.Event {
+		if e, ok := staged[id]; ok {
+			return e
+		}
+		return s.events[id]
+	}
+
+	results := make([]app.BulkResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		e := op.Event
+		results[i] = app.BulkResult{Index: i, EventID: e.ID}
+		if failed && atomic {
+			results[i].Err = app.ErrBulkAborted
+			continue
+		}
+
+		current := lookup(e.ID)
+		switch op.Type {
+		case app.BulkCreate:
+			if current != nil {
+				results[i].Err = storage.ErrEventAlreadyExist
+			} else {
+				staged[e.ID] = &e
+			}
+		case app.BulkUpdate:
+			if current == nil {
+				results[i].Err = storage.ErrEventDoesNotExist
+			} else if err := op.CheckOwner(*current); err != nil {
+				results[i].Err = err
+			} else {
+				before := *current
+				results[i].Before = &before
+				staged[e.ID] = &e
+			}
+		case app.BulkDelete:
+			if current == nil {
+				results[i].Err = storage.ErrEventDoesNotExist
+			} else if err := op.CheckOwner(*current); err != nil {
+				results[i].Err = err
+			} else {
+				before := *current
+				results[i].Before = &before
+				staged[e.ID] = nil
+			}
+		default:
+			results[i].Err = app.ErrBulkUnknownOperation
+		}
+		failed = failed || results[i].Err != nil
+	}
+
+	if failed && atomic {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = app.ErrBulkAborted
+				results[i].Before = nil
+			}
+		}
+		return results, nil
+	}
+
+	for id, e := range staged {
+		if e == nil {
+			s.deleteEvent(id)
+		} else {
+			s.putEvent(e)
+		}
+	}
+	return results, nil
+}
+
+func (s *EventDataStore) AddEventHistory(ctx context.Context, r app.EventHistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history[r.EventID] = append(s.history[r.EventID], r)
+	return nil
+}
+
+func (s *EventDataStore) EventHistory(ctx context.Context, eventID string) ([]app.EventHistoryRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]app.EventHistoryRecord, len(s.history[eventID]))
+	copy(records, s.history[eventID])
+	return records, nil
+}
+
+func (s *EventDataStore) NewWebhook(ctx context.Context, w app.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.webhooks[w.ID] != nil {
+		return storage.ErrWebhookAlreadyExist
+	}
+
+	s.webhooks[w.ID] = &w
+	return nil
+}
+
+func (s *EventDataStore) RemoveWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.webhooks[id] == nil {
+		return storage.ErrWebhookDoesNotExist
+	}
+
+	delete(s.webhooks, id)
+	delete(s.deliveries, id)
+	return nil
+}
+
+func (s *EventDataStore) Webhooks(ctx context.Context) ([]app.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]app.Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, nil
+}
+
+func (s *EventDataStore) AddWebhookDelivery(ctx context.Context, d app.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[d.WebhookID] = append(s.deliveries[d.WebhookID], d)
+	return nil
+}
+
+func (s *EventDataStore) WebhookDeliveries(ctx context.Context, webhookID string) ([]app.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.webhooks[webhookID] == nil {
+		return nil, storage.ErrWebhookDoesNotExist
+	}
+
+	deliveries := make([]app.WebhookDelivery, len(s.deliveries[webhookID]))
+	copy(deliveries, s.deliveries[webhookID])
+	return deliveries, nil
+}
+
+func (s *EventDataStore) SetUserTimezone(ctx context.Context, userID string, tz string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timezones[userID] = tz
+	return nil
+}
+
+func (s *EventDataStore) UserTimezone(ctx context.Context, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.timezones[userID], nil
+}
+
+// putEvent and deleteEvent keep indexes in sync with events map, s.mu must be locked.
+func (s *EventDataStore) putEvent(e *app.Event) {
+	s.deleteEvent(e.ID)
+	s.events[e.ID] = e
+	start, last := e.Span()
+	s.periods.Insert(e.ID, start, last)
+	s.starts.Insert(e.ID, e.StartDate)
+	s.reminders.Insert(e.ID, e.RemindIn)
+}
+
+func (s *EventDataStore) deleteEvent(id string) {
+	e := s.events[id]
+	if e == nil {
+		return
+	}
+	s.periods.Delete(id, e.StartDate)
+	s.starts.Delete(id, e.StartDate)
+	s.reminders.Delete(id, e.RemindIn)
+	delete(s.events, id)
+}
@@ -0,0 +1,97 @@
+package memorystorage
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+)
+
+const (
+	benchEvents = 200000
+	benchOwners = 1000
+	benchWindow = 3600
+)
+
+func benchStore(b *testing.B) *EventDataStore {
+	b.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	s := New()
+	for i := 0; i < benchEvents; i++ {
+		start := rnd.Int63n(365 * 24 * 3600)
+		e := app.Event{
+			ID:        strconv.Itoa(i),
+			StartDate: start,
+			EndDate:   start + rnd.Int63n(4*3600),
+			OwnerID:   strconv.Itoa(i % benchOwners),
+			RemindIn:  start - rnd.Int63n(3600),
+		}
+		if err := s.NewEvent(context.Background(), e); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s
+}
+
+// scanStartDate and scanReminderIn are the full map scans the store used before indexes, kept for comparison.
+func (s *EventDataStore) scanStartDate(from, to int64) []app.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []app.Event
+	for _, e := range s.events {
+		if e.StartDate >= from && e.StartDate <= to {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+func (s *EventDataStore) scanReminderIn(from, to int64) []app.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []app.Event
+	for _, e := range s.events {
+		if e.RemindIn >= from && e.RemindIn <= to {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+func BenchmarkStartDate(b *testing.B) {
+	s := benchStore(b)
+	ctx := context.Background()
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			from := int64(i%365) * 24 * 3600
+			_ = s.scanStartDate(from, from+benchWindow)
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			from := int64(i%365) * 24 * 3600
+			_, _ = s.EventListFilterByStartDate(ctx, from, from+benchWindow)
+		}
+	})
+}
+
+func BenchmarkReminderIn(b *testing.B) {
+	s := benchStore(b)
+	ctx := context.Background()
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			from := int64(i%365) * 24 * 3600
+			_ = s.scanReminderIn(from, from+benchWindow)
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			from := int64(i%365) * 24 * 3600
+			_, _ = s.EventListFilterByReminderIn(ctx, from, from+benchWindow)
+		}
+	})
+}
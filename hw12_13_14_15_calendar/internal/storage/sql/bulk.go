@@ -0,0 +1,165 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
+)
+
+type bulkStatements struct {
+	selectEvent *sqlx.Stmt
+	insert      *sqlx.Stmt
+	update      *sqlx.Stmt
+	delete      *sqlx.Stmt
+}
+
+func (s *EventDataStore) BulkApply(
+	ctx context.Context,
+	ops []app.BulkOperation,
+	atomic bool,
+) (_ []app.BulkResult, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "sqlstorage.BulkApply")
+	defer func() { tracing.End(span, err) }()
+	app.MarkSessionWritten(ctx)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, NewError("can't begin transaction", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmts := s.bulkStatements(ctx, tx)
+
+	results := make([]app.BulkResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		results[i] = app.BulkResult{Index: i, EventID: op.Event.ID}
+		if failed && atomic {
+			results[i].Err = app.ErrBulkAborted
+			continue
+		}
+
+		if err := s.applyBulkOperation(ctx, tx, stmts, op, atomic, &results[i]); err != nil {
+			return nil, err
+		}
+		failed = failed || results[i].Err != nil
+	}
+
+	if failed && atomic {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = app.ErrBulkAborted
+				results[i].Before = nil
+			}
+		}
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, NewError("can't commit transaction", err)
+	}
+	return results, nil
+}
+
+// bulkStatements binds the store statements to the transaction, they are not prepared again.
+func (s *EventDataStore) bulkStatements(ctx context.Context, tx *sqlx.Tx) *bulkStatements {
+	return &bulkStatements{
+		selectEvent: tx.StmtxContext(ctx, s.stmts.eventForUpdate),
+		insert:      tx.StmtxContext(ctx, s.stmts.insert),
+		update:      tx.StmtxContext(ctx, s.stmts.update),
+		delete:      tx.StmtxContext(ctx, s.stmts.delete),
+	}
+}
+
+// applyBulkOperation fills the operation result, returned error breaks the whole batch.
+func (s *EventDataStore) applyBulkOperation(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	stmts *bulkStatements,
+	op app.BulkOperation,
+	atomic bool,
+	result *app.BulkResult,
+) (err error) {
+	ctx, end := s.startQuery(ctx, "BulkApply."+string(op.Type))
+	defer end(&err)
+
+	// failed statement aborts the whole transaction in postgres,
+	// so every operation of best effort batch is wrapped into its own savepoint
+	if !atomic {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT bulk_operation"); err != nil {
+			return NewError("can't create savepoint", err)
+		}
+	}
+
+	result.Before, result.Err = stmts.apply(ctx, op)
+
+	if !atomic {
+		query := "RELEASE SAVEPOINT bulk_operation"
+		if result.Err != nil {
+			query = "ROLLBACK TO SAVEPOINT bulk_operation"
+		}
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return NewError("can't release savepoint", err)
+		}
+	}
+	return nil
+}
+
+func (st *bulkStatements) apply(ctx context.Context, op app.BulkOperation) (*app.Event, error) {
+	e := op.Event
+
+	var current *app.Event
+	var found app.Event
+	err := st.selectEvent.GetContext(ctx, &found, e.ID)
+	switch {
+	case err == nil:
+		current = &found
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, NewError("can't get event", err)
+	}
+	if current != nil {
+		if err := op.CheckOwner(*current); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Type {
+	case app.BulkCreate:
+		if current != nil {
+			return nil, storage.ErrEventAlreadyExist
+		}
+		_, err = st.insert.ExecContext(ctx, e.ID, e.Title, e.StartDate, e.EndDate, e.Description, e.OwnerID, e.RemindIn, e.Timezone,
+			e.AllDay, e.StartDay, e.EndDay)
+		if err != nil {
+			return nil, insertError(err)
+		}
+		return nil, nil
+	case app.BulkUpdate:
+		if current == nil {
+			return nil, storage.ErrEventDoesNotExist
+		}
+		_, err = st.update.ExecContext(ctx, e.Title, e.StartDate, e.EndDate, e.Description, e.OwnerID, e.RemindIn, e.Timezone,
+			e.AllDay, e.StartDay, e.EndDay, e.ID)
+		if err != nil {
+			return nil, NewError("can't update event", err)
+		}
+		return current, nil
+	case app.BulkDelete:
+		if current == nil {
+			return nil, storage.ErrEventDoesNotExist
+		}
+		if _, err = st.delete.ExecContext(ctx, e.ID); err != nil {
+			return nil, NewError("can't delete event from db", err)
+		}
+		return current, nil
+	default:
+		return nil, app.ErrBulkUnknownOperation
+	}
+}
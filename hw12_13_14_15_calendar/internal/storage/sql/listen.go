@@ -0,0 +1,64 @@
+package sqlstorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+)
+
+const (
+	// changesChannel is notified by the event table trigger on every insert, update and delete
+	changesChannel        = "event_changes"
+	changesReconnectDelay = time.Second
+)
+
+// eventChange is the notification payload, it has only the fields range queries depend on.
+type eventChange struct {
+	Before *app.Event `json:"before"`
+	After  *app.Event `json:"after"`
+}
+
+// ListenChanges calls fn for every event change committed by any process until ctx is done,
+// it has its own connection and reconnects on failures. Changes made while it is not listening
+// are lost, so fn is called with both nil every time listening starts.
+func (s *EventDataStore) ListenChanges(ctx context.Context, fn func(before, after *app.Event)) {
+	for {
+		_ = s.listenChanges(ctx, fn)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changesReconnectDelay):
+		}
+	}
+}
+
+func (s *EventDataStore) listenChanges(ctx context.Context, fn func(before, after *app.Event)) error {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return NewError("can't connect to listen changes", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return NewError("can't listen changes", err)
+	}
+	fn(nil, nil)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return NewError("can't wait for change", err)
+		}
+
+		var c eventChange
+		if err := json.Unmarshal([]byte(n.Payload), &c); err != nil {
+			fn(nil, nil)
+			continue
+		}
+		fn(c.Before, c.After)
+	}
+}
@@ -0,0 +1,369 @@
+package sqlstorage
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/migrations"
+)
+
+const (
+	// migrationLockKey is the pg_advisory_lock key, so two binaries never migrate one db at the same time.
+	migrationLockKey = 20201207195903
+
+	createSchemaVersionQuery = `CREATE TABLE IF NOT EXISTS schema_version (
+				version bigint NOT NULL,
+				applied_at timestamptz NOT NULL DEFAULT now(),
+				PRIMARY KEY (version)
+			)`
+	// the db may be migrated by goose before, its applied versions are the last applied records of goose table.
+	selectGooseVersionsQuery = `SELECT version_id FROM goose_db_version
+			WHERE id IN (SELECT max(id) FROM goose_db_version GROUP BY version_id) AND is_applied AND version_id > 0`
+	importGooseVersionsQuery  = "INSERT INTO schema_version (version) " + selectGooseVersionsQuery
+	selectSchemaVersionsQuery = "SELECT version, applied_at FROM schema_version"
+
+	migrationUpAnnotation   = "-- +goose Up"
+	migrationDownAnnotation = "-- +goose Down"
+	migrationAnnotation     = "-- +goose"
+)
+
+var (
+	ErrPendingMigrations   = NewError("db has pending migrations", nil)
+	ErrNoAppliedMigrations = NewError("no applied migration to roll back", nil)
+
+	migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is zero for a pending migration
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := ParseMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// OpenMigrator connects with embedded migrations, the storage itself can't start on a not migrated schema.
+func OpenMigrator(ctx context.Context, dsn string) (*Migrator, error) {
+	db, err := open(ctx, dsn, PoolConf{})
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close closes the underlying db.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// ParseMigrations reads <version>_<name>.sql files of fsys root sorted by version.
+func ParseMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, NewError("can't list migrations", err)
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	versions := make(map[int64]string, len(files))
+	for _, f := range files {
+		m, err := parseMigration(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		if dup, ok := versions[m.Version]; ok {
+			return nil, NewError(fmt.Sprintf("migrations %s and %s have the same version", dup, f), nil)
+		}
+		versions[m.Version] = f
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func parseMigration(fsys fs.FS, file string) (Migration, error) {
+	match := migrationFileRe.FindStringSubmatch(file)
+	if match == nil {
+		return Migration{}, NewError("invalid migration file name "+file, nil)
+	}
+	version, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return Migration{}, NewError("invalid migration version "+file, err)
+	}
+
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return Migration{}, NewError("can't read migration "+file, err)
+	}
+
+	var up, down strings.Builder
+	var section *strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch trimmed := strings.TrimSpace(line); {
+		case strings.HasPrefix(trimmed, migrationUpAnnotation):
+			section = &up
+		case strings.HasPrefix(trimmed, migrationDownAnnotation):
+			section = &down
+		case strings.HasPrefix(trimmed, migrationAnnotation):
+			// StatementBegin/End are not needed, every section is executed as one simple query
+		case section != nil:
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Migration{}, NewError("can't read migration "+file, err)
+	}
+	if strings.TrimSpace(up.String()) == "" {
+		return Migration{}, NewError("migration "+file+" has no up section", nil)
+	}
+
+	return Migration{Version: version, Name: match[2], Up: up.String(), Down: down.String()}, nil
+}
+
+// Up applies all pending migrations in the order of version, every one in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := versions[mig.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, mig.Up, "INSERT INTO schema_version (version) VALUES ($1)", mig.Version)
+			if err != nil {
+				return NewError(fmt.Sprintf("can't apply migration %d_%s", mig.Version, mig.Name), err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := versions[mig.Version]; !ok {
+				continue
+			}
+			err := inTx(ctx, conn, mig.Down, "DELETE FROM schema_version WHERE version=$1", mig.Version)
+			if err != nil {
+				return NewError(fmt.Sprintf("can't roll back migration %d_%s", mig.Version, mig.Name), err)
+			}
+			rolledBack = mig
+			return nil
+		}
+		return ErrNoAppliedMigrations
+	})
+	return rolledBack, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		statuses = make([]MigrationStatus, 0, len(m.migrations))
+		for _, mig := range m.migrations {
+			statuses = append(statuses, MigrationStatus{Migration: mig, AppliedAt: versions[mig.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns not applied migrations without taking the lock and creating the schema_version table.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	var versionTable string
+	err := m.db.GetContext(ctx, &versionTable, `SELECT CASE
+			WHEN to_regclass('schema_version') IS NOT NULL THEN 'schema_version'
+			WHEN to_regclass('goose_db_version') IS NOT NULL THEN 'goose_db_version'
+			ELSE '' END`)
+	if err != nil {
+		return nil, NewError("can't check schema_version table", err)
+	}
+
+	var applied []int64
+	switch versionTable {
+	case "schema_version":
+		err = m.db.SelectContext(ctx, &applied, "SELECT version FROM schema_version")
+	case "goose_db_version":
+		err = m.db.SelectContext(ctx, &applied, selectGooseVersionsQuery)
+	}
+	if err != nil {
+		return nil, NewError("can't select schema versions", err)
+	}
+	versions := make(map[int64]struct{}, len(applied))
+	for _, v := range applied {
+		versions[v] = struct{}{}
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := versions[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the session advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return NewError("can't get db connection", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return NewError("can't take migration lock", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey) // nolint: errcheck
+
+	if _, err := conn.ExecContext(ctx, createSchemaVersionQuery); err != nil {
+		return NewError("can't create schema_version table", err)
+	}
+	if err := importGooseVersions(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func importGooseVersions(ctx context.Context, conn *sql.Conn) error {
+	var gooseExist bool
+	err := conn.QueryRowContext(ctx, "SELECT to_regclass('goose_db_version') IS NOT NULL").Scan(&gooseExist)
+	if err != nil {
+		return NewError("can't check goose_db_version table", err)
+	}
+	if !gooseExist {
+		return nil
+	}
+
+	var versionsExist bool
+	err = conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_version)").Scan(&versionsExist)
+	if err != nil {
+		return NewError("can't select schema versions", err)
+	}
+	if versionsExist {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, importGooseVersionsQuery); err != nil {
+		return NewError("can't import goose versions", err)
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, selectSchemaVersionsQuery)
+	if err != nil {
+		return nil, NewError("can't select schema versions", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, NewError("can't scan schema version", err)
+		}
+		versions[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewError("can't select schema versions", err)
+	}
+	return versions, nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, migration, versionQuery string, version int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	if strings.TrimSpace(migration) != "" {
+		if _, err := tx.ExecContext(ctx, migration); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, versionQuery, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateMigration writes an empty goose formatted migration into dir and returns its path.
+func CreateMigration(dir, name string, now time.Time) (string, error) {
+	file := fmt.Sprintf("%s_%s.sql", now.UTC().Format("20060102150405"), name)
+	if !migrationFileRe.MatchString(file) {
+		return "", NewError("invalid migration name "+name, nil)
+	}
+
+	path := filepath.Join(dir, file)
+	body := migrationUpAnnotation + "\n\n" + migrationDownAnnotation + "\n"
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", NewError("can't create migration file", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(body); err != nil {
+		return "", NewError("can't write migration file", err)
+	}
+	return path, nil
+}
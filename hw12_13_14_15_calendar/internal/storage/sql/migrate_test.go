@@ -0,0 +1,117 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEmbeddedMigrations(t *testing.T) {
+	ms, err := ParseMigrations(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, ms)
+
+	for i, m := range ms {
+		require.NotEmpty(t, m.Up, m.Name)
+		require.NotEmpty(t, m.Down, m.Name)
+		if i > 0 {
+			require.Less(t, ms[i-1].Version, m.Version)
+		}
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	t.Run("sections", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"2_second.sql": {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nSELECT 2;\n-- +goose StatementEnd\n")},
+			"1_first.sql":  {Data: []byte("-- comment\n-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT -1;\n")},
+			"readme.txt":   {Data: []byte("not a migration")},
+		}
+		ms, err := ParseMigrations(fsys)
+		require.NoError(t, err)
+		require.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "SELECT 1;\n\n", Down: "SELECT -1;\n"},
+			{Version: 2, Name: "second", Up: "SELECT 2;\n"},
+		}, ms)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, fsys := range map[string]fstest.MapFS{
+			"name":      {"first.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}},
+			"no up":     {"1_first.sql": {Data: []byte("-- +goose Down\nSELECT 1;")}},
+			"duplicate": {"1_a.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}, "01_b.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}},
+		} {
+			_, err := ParseMigrations(fsys)
+			require.Error(t, err, name)
+		}
+	})
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir, err := os.MkdirTemp("", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)
+	path, err := CreateMigration(dir, "add_something", now)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "20261019180000_add_something.sql"), path)
+
+	_, err = CreateMigration(dir, "add_something", now)
+	require.Error(t, err)
+	_, err = CreateMigration(dir, "bad name", now)
+	require.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), migrationUpAnnotation)
+	require.Contains(t, string(data), migrationDownAnnotation)
+}
+
+func TestMigrator(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skip(testDSNEnv + " is not set")
+	}
+
+	ctx := context.Background()
+	m, err := OpenMigrator(ctx, dsn)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	last, err := m.Down(ctx)
+	require.NoError(t, err)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{last}, pending)
+
+	_, err = NewWithDSN(ctx, dsn, RequireMigrated())
+	require.True(t, errors.Is(err, ErrPendingMigrations))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{last}, applied)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, st := range statuses {
+		require.False(t, st.AppliedAt.IsZero(), st.Name)
+	}
+
+	migrated, err := NewWithDSN(ctx, dsn, RequireMigrated())
+	require.NoError(t, err)
+	require.NoError(t, migrated.Close())
+}
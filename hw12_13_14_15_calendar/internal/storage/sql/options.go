@@ -0,0 +1,101 @@
+package sqlstorage
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+)
+
+type Option func(*options)
+
+type options struct {
+	requireMigrated bool
+	pool            PoolConf
+	queryTimeout    time.Duration
+	replicas        []string
+	replicaCheck    time.Duration
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// PoolConf tunes database/sql pool, zero fields keep the driver defaults.
+type PoolConf struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (c PoolConf) apply(db *sqlx.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// RequireMigrated makes New fail with ErrPendingMigrations until all embedded migrations are applied.
+func RequireMigrated() Option {
+	return func(o *options) {
+		o.requireMigrated = true
+	}
+}
+
+func WithPool(c PoolConf) Option {
+	return func(o *options) {
+		o.pool = c
+	}
+}
+
+// WithQueryTimeout bounds every storage call, bulk operations are bounded one by one.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = d
+	}
+}
+
+// WithReplicas routes event list reads to the replicas, interval is the health check period of them.
+func WithReplicas(dsns []string, interval time.Duration) Option {
+	return func(o *options) {
+		o.replicas = dsns
+		o.replicaCheck = interval
+	}
+}
+
+// ConfOptions turns the database section of a service config into options, all services share it.
+func ConfOptions(cfg config.DBConf) []Option {
+	opts := []Option{
+		WithPool(PoolConf{
+			MaxOpenConns:    cfg.MaxOpenConns,
+			MaxIdleConns:    cfg.MaxIdleConns,
+			ConnMaxLifetime: time.Duration(cfg.ConnMaxLifetimeInSec) * time.Second,
+			ConnMaxIdleTime: time.Duration(cfg.ConnMaxIdleTimeInSec) * time.Second,
+		}),
+		WithQueryTimeout(time.Duration(cfg.QueryTimeoutInMs) * time.Millisecond),
+	}
+	if cfg.RequireMigrated {
+		opts = append(opts, RequireMigrated())
+	}
+	if len(cfg.Replicas) > 0 {
+		dsns := make([]string, len(cfg.Replicas))
+		for i, addr := range cfg.Replicas {
+			dsns[i] = DSN(cfg.Username, cfg.Password, addr, cfg.DBName)
+		}
+		opts = append(opts, WithReplicas(dsns, time.Duration(cfg.ReplicaCheckIntervalInSec)*time.Second))
+	}
+	return opts
+}
@@ -0,0 +1,33 @@
+package sqlstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfOptions(t *testing.T) {
+	o := newOptions(ConfOptions(config.DBConf{
+		Username:                  "user",
+		Password:                  "pass",
+		DBName:                    "calendar",
+		RequireMigrated:           true,
+		MaxOpenConns:              10,
+		ConnMaxLifetimeInSec:      60,
+		QueryTimeoutInMs:          500,
+		Replicas:                  []string{"replica:5432"},
+		ReplicaCheckIntervalInSec: 5,
+	}))
+
+	require.True(t, o.requireMigrated)
+	require.Equal(t, PoolConf{MaxOpenConns: 10, ConnMaxLifetime: time.Minute}, o.pool)
+	require.Equal(t, 500*time.Millisecond, o.queryTimeout)
+	require.Equal(t, []string{DSN("user", "pass", "replica:5432", "calendar")}, o.replicas)
+	require.Equal(t, 5*time.Second, o.replicaCheck)
+
+	o = newOptions(ConfOptions(config.DBConf{}))
+	require.False(t, o.requireMigrated)
+	require.Empty(t, o.replicas)
+}
@@ -0,0 +1,125 @@
+package sqlstorage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+)
+
+const defaultReplicaCheckInterval = 5 * time.Second
+
+type replica struct {
+	db      *sqlx.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) setHealthy(ok bool) {
+	var v int32
+	if ok {
+		v = 1
+	}
+	atomic.StoreInt32(&r.healthy, v)
+}
+
+// replicaSet routes reads and keeps replica health up to date in background.
+type replicaSet struct {
+	stats    storage.RoutingStats
+	replicas []*replica
+	next     uint32
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// openReplicas does not fail on unreachable replica, it is only marked unhealthy until the next check.
+func openReplicas(ctx context.Context, dsns []string, pool PoolConf, interval time.Duration) (*replicaSet, error) {
+	rs := &replicaSet{done: make(chan struct{})}
+	for _, dsn := range dsns {
+		db, err := sqlx.Open("pgx", dsn)
+		if err != nil {
+			rs.close()
+			return nil, NewError("can't create replica db", err)
+		}
+		pool.apply(db)
+		r := &replica{db: db}
+		r.setHealthy(db.PingContext(ctx) == nil)
+		rs.replicas = append(rs.replicas, r)
+	}
+
+	if len(rs.replicas) > 0 {
+		if interval <= 0 {
+			interval = defaultReplicaCheckInterval
+		}
+		rs.wg.Add(1)
+		go rs.check(interval)
+	}
+	return rs, nil
+}
+
+func (rs *replicaSet) check(interval time.Duration) {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-ticker.C:
+			for _, r := range rs.replicas {
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				r.setHealthy(r.db.PingContext(ctx) == nil)
+				cancel()
+			}
+		}
+	}
+}
+
+// pick returns a healthy replica in round robin or nil when the read must go to the primary.
+func (rs *replicaSet) pick(ctx context.Context) *replica {
+	if len(rs.replicas) == 0 {
+		atomic.AddInt64(&rs.stats.PrimaryReads, 1)
+		return nil
+	}
+	if app.SessionWritten(ctx) {
+		atomic.AddInt64(&rs.stats.ReadYourWrites, 1)
+		return nil
+	}
+
+	healthy := make([]*replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		atomic.AddInt64(&rs.stats.PrimaryReads, 1)
+		return nil
+	}
+	return healthy[int(atomic.AddUint32(&rs.next, 1))%len(healthy)]
+}
+
+func (rs *replicaSet) snapshot() storage.RoutingStats {
+	return storage.RoutingStats{
+		ReplicaReads:   atomic.LoadInt64(&rs.stats.ReplicaReads),
+		PrimaryReads:   atomic.LoadInt64(&rs.stats.PrimaryReads),
+		ReadYourWrites: atomic.LoadInt64(&rs.stats.ReadYourWrites),
+		Fallbacks:      atomic.LoadInt64(&rs.stats.Fallbacks),
+	}
+}
+
+func (rs *replicaSet) close() {
+	close(rs.done)
+	rs.wg.Wait()
+	for _, r := range rs.replicas {
+		r.db.Close()
+	}
+}
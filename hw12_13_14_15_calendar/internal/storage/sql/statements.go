@@ -0,0 +1,76 @@
+package sqlstorage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	selectEventByIDQuery = selectEventQuery + `
+			WHERE id=$1`
+	selectEventForUpdateQuery = selectEventByIDQuery + `
+			FOR UPDATE`
+	eventExistsQuery = `SELECT COUNT(*)
+			FROM event
+			WHERE id=$1`
+	selectByStartDateQuery = selectEventQuery + `
+			WHERE start_date >=$1 AND start_date <=$2
+			ORDER BY start_date`
+	selectByPeriodQuery = selectEventQuery + `
+			WHERE period && numrange($1::numeric, $2::numeric, '[]')
+			ORDER BY start_date`
+	selectByReminderInQuery = selectEventQuery + `
+			WHERE remind_in >=$1 AND remind_in <=$2
+			ORDER BY remind_in`
+)
+
+// statements are the hot queries prepared once per store, database/sql reprepares them on new connections.
+type statements struct {
+	event          *sqlx.Stmt
+	eventForUpdate *sqlx.Stmt
+	eventExists    *sqlx.Stmt
+	insert         *sqlx.Stmt
+	update         *sqlx.Stmt
+	delete         *sqlx.Stmt
+	byStartDate    *sqlx.Stmt
+	byPeriod       *sqlx.Stmt
+	byReminderIn   *sqlx.Stmt
+}
+
+func prepareStatements(ctx context.Context, db *sqlx.DB) (*statements, error) {
+	var stmts statements
+	for _, p := range []struct {
+		stmt  **sqlx.Stmt
+		query string
+	}{
+		{&stmts.event, selectEventByIDQuery},
+		{&stmts.eventForUpdate, selectEventForUpdateQuery},
+		{&stmts.eventExists, eventExistsQuery},
+		{&stmts.insert, insertEventQuery},
+		{&stmts.update, updateEventQuery},
+		{&stmts.delete, deleteEventQuery},
+		{&stmts.byStartDate, selectByStartDateQuery},
+		{&stmts.byPeriod, selectByPeriodQuery},
+		{&stmts.byReminderIn, selectByReminderInQuery},
+	} {
+		stmt, err := db.PreparexContext(ctx, p.query)
+		if err != nil {
+			stmts.close()
+			return nil, NewError("can't prepare statement", err)
+		}
+		*p.stmt = stmt
+	}
+	return &stmts, nil
+}
+
+func (st *statements) close() {
+	for _, stmt := range []*sqlx.Stmt{
+		st.event, st.eventForUpdate, st.eventExists, st.insert, st.update, st.delete,
+		st.byStartDate, st.byPeriod, st.byReminderIn,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
@@ -3,13 +3,53 @@ package sqlstorage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib" // nolint: gci
 	"github.com/jmoiron/sqlx"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/migrations"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	selectEventQuery = `SELECT id, 
+       			title, 
+       			start_date, 
+    		    end_date, 
+    		    description, 
+    		    owner_id, 
+    		    remind_in, 
+    		    timezone, 
+    		    all_day, 
+    		    start_day, 
+    		    end_day
+			FROM event`
+	insertEventQuery = `INSERT INTO event (id, title, start_date, end_date, description,  owner_id,  remind_in, timezone, 
+				all_day, start_day, end_day) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	updateEventQuery = `UPDATE event
+			SET title=$1,
+    		    start_date=$2, 
+    		    end_date=$3, 
+    		    description=$4, 
+    		    owner_id=$5, 
+    		    remind_in=$6, 
+    		    timezone=$7, 
+    		    all_day=$8, 
+    		    start_day=$9, 
+    		    end_day=$10
+			WHERE id=$11`
+	deleteEventQuery = "DELETE FROM event WHERE id=$1"
+
+	uniqueViolationCode = "23505"
 )
 
 type SQLError struct {
@@ -20,30 +60,128 @@ func NewError(msg string, err error) *SQLError {
 	return &SQLError{BaseError: app.BaseError{Message: msg, Err: err}}
 }
 
+// insertError answers already exist when a concurrent writer inserted the same id
+// between the existence check and the insert.
+func insertError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return storage.ErrEventAlreadyExist
+	}
+	return NewError("can't add event to db", err)
+}
+
 type EventDataStore struct {
-	db *sqlx.DB
+	dsn          string
+	db           *sqlx.DB
+	stmts        *statements
+	replicas     *replicaSet
+	queryTimeout time.Duration
+}
+
+func DSN(user, pass, addr, dbName string) string {
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", user, pass, addr, dbName)
+}
+
+func New(ctx context.Context, user, pass, addr, dbName string, opts ...Option) (*EventDataStore, error) {
+	return NewWithDSN(ctx, DSN(user, pass, addr, dbName), opts...)
 }
 
-func New(ctx context.Context, user, pass, addr, dbName string) (*EventDataStore, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", user, pass, addr, dbName)
+func NewWithDSN(ctx context.Context, dsn string, opts ...Option) (*EventDataStore, error) {
+	o := newOptions(opts)
+
+	db, err := open(ctx, dsn, o.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.requireMigrated {
+		if err := checkMigrated(ctx, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	// statements are prepared after the check, they fail on not migrated schema
+	stmts, err := prepareStatements(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	replicas, err := openReplicas(ctx, o.replicas, o.pool, o.replicaCheck)
+	if err != nil {
+		stmts.close()
+		db.Close()
+		return nil, err
+	}
+
+	return &EventDataStore{dsn: dsn, db: db, stmts: stmts, replicas: replicas, queryTimeout: o.queryTimeout}, nil
+}
+
+func open(ctx context.Context, dsn string, pool PoolConf) (*sqlx.DB, error) {
 	db, err := sqlx.Open("pgx", dsn)
 	if err != nil {
 		return nil, NewError("can't create db store", err)
 	}
+	pool.apply(db)
 
 	err = db.PingContext(ctx)
 	if err != nil {
+		db.Close()
 		return nil, NewError("ping error", err)
 	}
+	return db, nil
+}
 
-	return &EventDataStore{db: db}, nil
+func checkMigrated(ctx context.Context, db *sqlx.DB) error {
+	m, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return NewError(fmt.Sprintf("first pending is %d_%s", pending[0].Version, pending[0].Name), ErrPendingMigrations)
+	}
+	return nil
 }
 
 func (s *EventDataStore) Close() error {
+	s.replicas.close()
+	s.stmts.close()
 	return s.db.Close()
 }
 
-func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
+func (s *EventDataStore) RoutingStats() storage.RoutingStats {
+	return s.replicas.snapshot()
+}
+
+// Ping checks the db is reachable within the query timeout.
+func (s *EventDataStore) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return NewError("ping error", err)
+	}
+	return nil
+}
+
+// withTimeout bounds a storage call with the query timeout, zero timeout keeps the caller deadline only.
+func (s *EventDataStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) (err error) {
+	ctx, end := s.startQuery(ctx, "NewEvent")
+	defer end(&err)
+	app.MarkSessionWritten(ctx)
+
 	isExist, err := s.eventIsExist(ctx, e.ID)
 	if err != nil {
 		return err
@@ -53,10 +191,8 @@ func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
 		return storage.ErrEventAlreadyExist
 	}
 
-	_, err = s.db.ExecContext(
+	_, err = s.stmts.insert.ExecContext(
 		ctx,
-		`INSERT INTO event (id, title, start_date, end_date, description,  owner_id,  remind_in) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		e.ID,
 		e.Title,
 		e.StartDate,
@@ -64,14 +200,22 @@ func (s *EventDataStore) NewEvent(ctx context.Context, e app.Event) error {
 		e.Description,
 		e.OwnerID,
 		e.RemindIn,
+		e.Timezone,
+		e.AllDay,
+		e.StartDay,
+		e.EndDay,
 	)
 	if err != nil {
-		return NewError("can't add event to db", err)
+		return insertError(err)
 	}
 	return nil
 }
 
-func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
+func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) (err error) {
+	ctx, end := s.startQuery(ctx, "UpdateEvent")
+	defer end(&err)
+	app.MarkSessionWritten(ctx)
+
 	isExist, err := s.eventIsExist(ctx, e.ID)
 	if err != nil {
 		return err
@@ -81,22 +225,18 @@ func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
 		return storage.ErrEventDoesNotExist
 	}
 
-	_, err = s.db.ExecContext(
+	_, err = s.stmts.update.ExecContext(
 		ctx,
-		`UPDATE event
-			SET title=$1,
-    		    start_date=$2, 
-    		    end_date=$3, 
-    		    description=$4, 
-    		    owner_id=$5, 
-    		    remind_in=$6
-			WHERE id=$7`,
 		e.Title,
 		e.StartDate,
 		e.EndDate,
 		e.Description,
 		e.OwnerID,
 		e.RemindIn,
+		e.Timezone,
+		e.AllDay,
+		e.StartDay,
+		e.EndDay,
 		e.ID,
 	)
 	if err != nil {
@@ -105,7 +245,11 @@ func (s *EventDataStore) UpdateEvent(ctx context.Context, e app.Event) error {
 	return nil
 }
 
-func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) error {
+func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) (err error) {
+	ctx, end := s.startQuery(ctx, "RemoveEvent")
+	defer end(&err)
+	app.MarkSessionWritten(ctx)
+
 	isExist, err := s.eventIsExist(ctx, id)
 	if err != nil {
 		return err
@@ -115,74 +259,328 @@ func (s *EventDataStore) RemoveEvent(ctx context.Context, id string) error {
 		return storage.ErrEventDoesNotExist
 	}
 
-	_, err = s.db.ExecContext(ctx, "DELETE FROM event WHERE id=$1", id)
+	_, err = s.stmts.delete.ExecContext(ctx, id)
 	if err != nil {
 		return NewError("can't delete event from db", err)
 	}
 	return nil
 }
 
+func (s *EventDataStore) Event(ctx context.Context, id string) (_ app.Event, err error) {
+	ctx, end := s.startQuery(ctx, "Event")
+	defer end(&err)
+
+	var event app.Event
+	err = s.stmts.event.GetContext(ctx, &event, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return app.Event{}, storage.ErrEventDoesNotExist
+		}
+		return app.Event{}, NewError("can't get event", err)
+	}
+	return event, nil
+}
+
 func (s *EventDataStore) EventListFilterByStartDate(ctx context.Context, from int64, to int64) ([]app.Event, error) {
-	var events []app.Event
-	err := s.db.SelectContext(
+	return s.selectEvents(ctx, "EventListFilterByStartDate", s.stmts.byStartDate, selectByStartDateQuery, from, to)
+}
+
+func (s *EventDataStore) EventListFilterByPeriod(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	// numrange fails when lower bound is greater than upper one
+	if from > to {
+		return nil, storage.ErrNoEvents
+	}
+
+	return s.selectEvents(ctx, "EventListFilterByPeriod", s.stmts.byPeriod, selectByPeriodQuery, from, to)
+}
+
+func (s *EventDataStore) EventListFilterByReminderIn(ctx context.Context, from int64, to int64) ([]app.Event, error) {
+	return s.selectEvents(ctx, "EventListFilterByReminderIn", s.stmts.byReminderIn, selectByReminderInQuery, from, to)
+}
+
+func (s *EventDataStore) AddEventHistory(ctx context.Context, r app.EventHistoryRecord) (err error) {
+	ctx, end := s.startQuery(ctx, "AddEventHistory")
+	defer end(&err)
+
+	before, err := json.Marshal(r.Before)
+	if err != nil {
+		return NewError("can't marshal event", err)
+	}
+
+	after, err := json.Marshal(r.After)
+	if err != nil {
+		return NewError("can't marshal event", err)
+	}
+
+	_, err = s.db.ExecContext(
 		ctx,
-		&events,
-		`SELECT id, 
-       			title, 
-       			start_date, 
-    		    end_date, 
-    		    description, 
-    		    owner_id, 
-    		    remind_in
-			FROM event
-			WHERE start_date >=$1 AND start_date <=$2`,
-		from, to,
+		`INSERT INTO event_history (event_id, action, actor, date, before, after) 
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+		r.EventID,
+		r.Action,
+		r.Actor,
+		r.Date,
+		string(before),
+		string(after),
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, storage.ErrNoEvents
+		return NewError("can't add event history to db", err)
+	}
+	return nil
+}
+
+func (s *EventDataStore) EventHistory(ctx context.Context, eventID string) (_ []app.EventHistoryRecord, err error) {
+	ctx, end := s.startQuery(ctx, "EventHistory")
+	defer end(&err)
+
+	var rows []struct {
+		EventID string          `db:"event_id"`
+		Action  app.EventAction `db:"action"`
+		Actor   string          `db:"actor"`
+		Date    int64           `db:"date"`
+		Before  []byte          `db:"before"`
+		After   []byte          `db:"after"`
+	}
+	err = s.db.SelectContext(
+		ctx,
+		&rows,
+		`SELECT event_id, 
+       			action, 
+       			actor, 
+    		    date, 
+    		    before, 
+    		    after
+			FROM event_history
+			WHERE event_id=$1
+			ORDER BY id`,
+		eventID,
+	)
+	if err != nil {
+		return nil, NewError("can't select event history from db", err)
+	}
+
+	records := make([]app.EventHistoryRecord, len(rows))
+	for i, row := range rows {
+		records[i] = app.EventHistoryRecord{
+			EventID: row.EventID,
+			Action:  row.Action,
+			Actor:   row.Actor,
+			Date:    row.Date,
+		}
+		if err := json.Unmarshal(row.Before, &records[i].Before); err != nil {
+			return nil, NewError("can't unmarshal event", err)
+		}
+		if err := json.Unmarshal(row.After, &records[i].After); err != nil {
+			return nil, NewError("can't unmarshal event", err)
 		}
-		return nil, NewError("can't select events from db", err)
 	}
-	return events, nil
+	return records, nil
 }
 
-func (s *EventDataStore) EventListFilterByReminderIn(ctx context.Context, from int64, to int64) ([]app.Event, error) {
-	var events []app.Event
-	err := s.db.SelectContext(
+func (s *EventDataStore) NewWebhook(ctx context.Context, w app.Webhook) (err error) {
+	ctx, end := s.startQuery(ctx, "NewWebhook")
+	defer end(&err)
+
+	actions, err := json.Marshal(w.Actions)
+	if err != nil {
+		return NewError("can't marshal webhook actions", err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO webhook (id, url, secret, actions, owner_id, user_id) 
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO NOTHING`,
+		w.ID,
+		w.URL,
+		w.Secret,
+		string(actions),
+		w.OwnerID,
+		w.UserID,
+	)
+	if err != nil {
+		return NewError("can't add webhook to db", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return NewError("can't add webhook to db", err)
+	}
+	if affected == 0 {
+		return storage.ErrWebhookAlreadyExist
+	}
+	return nil
+}
+
+func (s *EventDataStore) RemoveWebhook(ctx context.Context, id string) (err error) {
+	ctx, end := s.startQuery(ctx, "RemoveWebhook")
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhook WHERE id=$1", id)
+	if err != nil {
+		return NewError("can't delete webhook from db", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return NewError("can't delete webhook from db", err)
+	}
+	if affected == 0 {
+		return storage.ErrWebhookDoesNotExist
+	}
+	return nil
+}
+
+func (s *EventDataStore) Webhooks(ctx context.Context) (_ []app.Webhook, err error) {
+	ctx, end := s.startQuery(ctx, "Webhooks")
+	defer end(&err)
+
+	var rows []struct {
+		ID      string `db:"id"`
+		URL     string `db:"url"`
+		Secret  string `db:"secret"`
+		Actions []byte `db:"actions"`
+		OwnerID string `db:"owner_id"`
+		UserID  string `db:"user_id"`
+	}
+	err = s.db.SelectContext(
 		ctx,
-		&events,
+		&rows,
 		`SELECT id, 
-       			title, 
-       			start_date, 
-    		    end_date, 
-    		    description, 
+       			url, 
+       			secret, 
+    		    actions, 
     		    owner_id, 
-    		    remind_in
-			FROM event
-			WHERE remind_in >=$1 AND remind_in <=$2`,
-		from, to,
+    		    user_id
+			FROM webhook`,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, storage.ErrNoEvents
+		return nil, NewError("can't select webhooks from db", err)
+	}
+
+	webhooks := make([]app.Webhook, len(rows))
+	for i, row := range rows {
+		webhooks[i] = app.Webhook{
+			ID:      row.ID,
+			URL:     row.URL,
+			Secret:  row.Secret,
+			OwnerID: row.OwnerID,
+			UserID:  row.UserID,
+		}
+		if err := json.Unmarshal(row.Actions, &webhooks[i].Actions); err != nil {
+			return nil, NewError("can't unmarshal webhook actions", err)
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *EventDataStore) AddWebhookDelivery(ctx context.Context, d app.WebhookDelivery) (err error) {
+	ctx, end := s.startQuery(ctx, "AddWebhookDelivery")
+	defer end(&err)
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO webhook_delivery (webhook_id, delivery_id, event_id, action, attempt, status_code, error, success, date) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		d.WebhookID,
+		d.DeliveryID,
+		d.EventID,
+		d.Action,
+		d.Attempt,
+		d.StatusCode,
+		d.Error,
+		d.Success,
+		d.Date,
+	)
+	if err != nil {
+		return NewError("can't add webhook delivery to db", err)
+	}
+	return nil
+}
+
+func (s *EventDataStore) WebhookDeliveries(ctx context.Context, webhookID string) (_ []app.WebhookDelivery, err error) {
+	ctx, end := s.startQuery(ctx, "WebhookDeliveries")
+	defer end(&err)
+
+	var count int
+	err = s.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM webhook WHERE id=$1", webhookID)
+	if err != nil {
+		return nil, NewError("can't get webhook", err)
+	}
+	if count == 0 {
+		return nil, storage.ErrWebhookDoesNotExist
+	}
+
+	deliveries := []app.WebhookDelivery{}
+	err = s.db.SelectContext(
+		ctx,
+		&deliveries,
+		`SELECT webhook_id, 
+       			delivery_id, 
+       			event_id, 
+    		    action, 
+    		    attempt, 
+    		    status_code, 
+    		    error, 
+    		    success, 
+    		    date
+			FROM webhook_delivery
+			WHERE webhook_id=$1
+			ORDER BY id`,
+		webhookID,
+	)
+	if err != nil {
+		return nil, NewError("can't select webhook deliveries from db", err)
+	}
+	return deliveries, nil
+}
+
+// selectEvents reads from a replica when there is a healthy one and falls back to the primary statement,
+// it returns ErrNoEvents instead of an empty list like other storages do.
+func (s *EventDataStore) selectEvents(
+	ctx context.Context,
+	operation string,
+	stmt *sqlx.Stmt,
+	query string,
+	args ...interface{},
+) (_ []app.Event, err error) {
+	ctx, end := s.startQuery(ctx, operation)
+	defer end(&err)
+
+	var events []app.Event
+	if r := s.replicas.pick(ctx); r != nil {
+		err := r.db.SelectContext(ctx, &events, query, args...)
+		switch {
+		case err == nil:
+			atomic.AddInt64(&s.replicas.stats.ReplicaReads, 1)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("db.replica", true))
+			return noEvents(events)
+		case ctx.Err() != nil:
+			return nil, NewError("can't select events from db", err)
 		}
+		r.setHealthy(false)
+		atomic.AddInt64(&s.replicas.stats.Fallbacks, 1)
+		events = nil
+	}
+
+	err = stmt.SelectContext(ctx, &events, args...)
+	if err != nil {
 		return nil, NewError("can't select events from db", err)
 	}
+	return noEvents(events)
+}
+
+func noEvents(events []app.Event) ([]app.Event, error) {
+	if len(events) == 0 {
+		return nil, storage.ErrNoEvents
+	}
 	return events, nil
 }
 
 func (s *EventDataStore) eventIsExist(ctx context.Context, id string) (bool, error) {
 	var count int
 
-	err := s.db.GetContext(
-		ctx,
-		&count,
-		`SELECT COUNT(*)
-			FROM event
-			WHERE id=$1`,
-		id,
-	)
+	err := s.stmts.eventExists.GetContext(ctx, &count, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false, nil
@@ -192,3 +590,55 @@ func (s *EventDataStore) eventIsExist(ctx context.Context, id string) (bool, err
 
 	return count > 0, nil
 }
+
+func (s *EventDataStore) SetUserTimezone(ctx context.Context, userID string, tz string) (err error) {
+	ctx, end := s.startQuery(ctx, "SetUserTimezone")
+	defer end(&err)
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO user_settings (user_id, timezone) 
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET timezone=EXCLUDED.timezone`,
+		userID,
+		tz,
+	)
+	if err != nil {
+		return NewError("can't save user timezone", err)
+	}
+	return nil
+}
+
+func (s *EventDataStore) UserTimezone(ctx context.Context, userID string) (_ string, err error) {
+	ctx, end := s.startQuery(ctx, "UserTimezone")
+	defer end(&err)
+
+	var tz string
+	err = s.db.GetContext(ctx, &tz, "SELECT timezone FROM user_settings WHERE user_id=$1", userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", NewError("can't get user timezone", err)
+	}
+	return tz, nil
+}
+
+// AddNotification stores a sent notification, it's used by the sender instead of the events API.
+func (s *EventDataStore) AddNotification(ctx context.Context, n app.MQEventNotification) (err error) {
+	ctx, end := s.startQuery(ctx, "AddNotification")
+	defer end(&err)
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO notification (id, title, start_date) 
+			VALUES ($1, $2, $3)`,
+		n.EventID,
+		n.Title,
+		n.Date,
+	)
+	if err != nil {
+		return NewError("can't create notification in db", err)
+	}
+	return nil
+}
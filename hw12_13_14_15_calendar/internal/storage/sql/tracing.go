@@ -0,0 +1,59 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startQuery bounds a storage call with the query timeout and traces it as a db client span,
+// the returned func ends both and has to be deferred with the address of the named error result.
+func (s *EventDataStore) startQuery(ctx context.Context, operation string) (context.Context, func(*error)) {
+	ctx, cancel := s.withTimeout(ctx)
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		"sqlstorage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationKey.String(operation)),
+	)
+
+	return ctx, func(err *error) {
+		// a query cut by its own deadline or by the caller says nothing about the db
+		if ctx.Err() == nil && unavailable(*err) {
+			*err = &SQLError{BaseError: app.BaseError{
+				Kind:    app.KindUnavailable,
+				Code:    "storage_unavailable",
+				Message: "db is unavailable",
+				Err:     *err,
+			}}
+		}
+		// not found and already exist are answers, not failures of the query
+		var storageErr *storage.Error
+		if errors.As(*err, &storageErr) {
+			tracing.End(span, nil)
+		} else {
+			tracing.End(span, *err)
+		}
+		cancel()
+	}
+}
+
+// unavailable tells failures of the connection from failures of the query itself,
+// callers may retry the first ones later. Expired and canceled contexts are left out.
+func unavailable(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.As(err, &netErr)
+}
@@ -0,0 +1,19 @@
+package storage
+
+// CacheStats counts lookups of the caching storage.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// RoutingStats counts where the event list reads were sent.
+type RoutingStats struct {
+	// ReplicaReads are served by a replica
+	ReplicaReads int64
+	// PrimaryReads are sent to the primary as there is no healthy replica
+	PrimaryReads int64
+	// ReadYourWrites are sent to the primary as the session wrote before
+	ReadYourWrites int64
+	// Fallbacks are retried on the primary after a replica failure
+	Fallbacks int64
+}
@@ -3,9 +3,12 @@ package storage
 import "github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
 
 var (
-	ErrEventAlreadyExist = NewError("event with this id already exist", nil)
-	ErrEventDoesNotExist = NewError("event does not exist", nil)
-	ErrNoEvents          = NewError("no one event", nil)
+	ErrEventAlreadyExist = newKindError(app.KindAlreadyExists, "event_already_exists", "event with this id already exist")
+	ErrEventDoesNotExist = newKindError(app.KindNotFound, "event_not_found", "event does not exist")
+	ErrNoEvents          = newKindError(app.KindNotFound, "no_events", "no one event")
+
+	ErrWebhookAlreadyExist = newKindError(app.KindAlreadyExists, "webhook_already_exists", "webhook with this id already exist")
+	ErrWebhookDoesNotExist = newKindError(app.KindNotFound, "webhook_not_found", "webhook does not exist")
 )
 
 type Error struct {
@@ -15,3 +18,7 @@ type Error struct {
 func NewError(msg string, err error) *Error {
 	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
 }
+
+func newKindError(kind app.Kind, code, msg string) *Error {
+	return &Error{BaseError: *app.NewKindError(kind, code, msg)}
+}
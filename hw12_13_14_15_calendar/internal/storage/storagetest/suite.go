@@ -0,0 +1,623 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/suite"
+)
+
+// Suite is the conformance suite which every app.Storage implementation must pass,
+// NewStorage is called before each test and must return an empty storage.
+// Range queries by start date and reminder include both bounds, the period query includes both bounds too,
+// every list query returns storage.ErrNoEvents instead of an empty list.
+type Suite struct {
+	suite.Suite
+	NewStorage func() app.Storage
+	store      app.Storage
+}
+
+func (m *Suite) SetupTest() {
+	m.store = m.NewStorage()
+	events := map[string]*app.Event{
+		"1": &app.Event{
+			ID:          "1",
+			Title:       "Title1",
+			StartDate:   1,
+			EndDate:     2,
+			Description: "Description1",
+			OwnerID:     "",
+			RemindIn:    5,
+		},
+		"2": &app.Event{
+			ID:          "2",
+			Title:       "Title2",
+			StartDate:   5,
+			EndDate:     25,
+			Description: "Description2",
+			OwnerID:     "",
+			RemindIn:    0,
+		},
+		"3": &app.Event{
+			ID:          "3",
+			Title:       "Title3",
+			StartDate:   6,
+			EndDate:     18,
+			Description: "Description3",
+			OwnerID:     "",
+			RemindIn:    0,
+		},
+		"4": &app.Event{
+			ID:          "4",
+			Title:       "Title4",
+			StartDate:   10,
+			EndDate:     12,
+			Description: "Description4",
+			OwnerID:     "",
+			RemindIn:    0,
+		},
+		"5": &app.Event{
+			ID:          "5",
+			Title:       "Title5",
+			StartDate:   15,
+			EndDate:     20,
+			Description: "Description5",
+			OwnerID:     "",
+			RemindIn:    0,
+		},
+	}
+	for _, e := range events {
+		m.Require().NoError(m.store.NewEvent(context.Background(), *e))
+	}
+}
+
+func (m *Suite) event(id string) *app.Event {
+	e, err := m.store.Event(context.Background(), id)
+	if err != nil {
+		return nil
+	}
+	return &e
+}
+
+func (m *Suite) TestInsertNewEventSuccess() {
+	newEvent := app.Event{
+		ID:          "6",
+		Title:       "Title6",
+		StartDate:   100500,
+		EndDate:     200200,
+		Description: "Description6",
+		OwnerID:     "",
+		RemindIn:    150,
+	}
+
+	err := m.store.NewEvent(context.Background(), newEvent)
+
+	m.Require().NoError(err)
+
+	saved := m.event("6")
+
+	m.Require().NotNil(saved)
+	m.Require().Equal(newEvent.Title, saved.Title)
+}
+
+func (m *Suite) TestInsertNewEventWithFail() {
+	newEvent := app.Event{
+		ID:          "1",
+		Title:       "Title6",
+		StartDate:   100500,
+		EndDate:     200200,
+		Description: "Description6",
+		OwnerID:     "",
+		RemindIn:    150,
+	}
+
+	err := m.store.NewEvent(context.Background(), newEvent)
+
+	m.Require().Error(err)
+	m.Require().EqualError(storage.ErrEventAlreadyExist, err.Error())
+	m.Require().Equal(app.KindAlreadyExists, app.KindOf(err))
+}
+
+func (m *Suite) TestUpdateEventSuccess() {
+	toUpdate := app.Event{
+		ID:          "1",
+		Title:       "TitleUpdated",
+		StartDate:   1,
+		EndDate:     2,
+		Description: "DescriptionUpdate",
+		OwnerID:     "",
+		RemindIn:    5,
+	}
+	err := m.store.UpdateEvent(context.Background(), toUpdate)
+
+	m.Require().NoError(err)
+
+	updated := m.event("1")
+
+	m.Require().NotNil(updated)
+	m.Require().Equal(toUpdate.Title, updated.Title)
+	m.Require().Equal(toUpdate.Description, updated.Description)
+}
+
+func (m *Suite) TestUpdateEventWithError() {
+	toUpdate := app.Event{
+		ID:          "6",
+		Title:       "Title6",
+		StartDate:   100500,
+		EndDate:     200200,
+		Description: "Description6",
+		OwnerID:     "",
+		RemindIn:    150,
+	}
+
+	err := m.store.UpdateEvent(context.Background(), toUpdate)
+
+	m.Require().Error(err)
+	m.Require().EqualError(storage.ErrEventDoesNotExist, err.Error())
+}
+
+func (m *Suite) TestRemoveEventSuccess() {
+	err := m.store.RemoveEvent(context.Background(), "1")
+
+	m.Require().NoError(err)
+
+	deleted := m.event("1")
+
+	m.Require().Nil(deleted)
+}
+
+func (m *Suite) TestRemoveEventWithError() {
+	err := m.store.RemoveEvent(context.Background(), "NaN")
+
+	m.Require().Error(err)
+	m.Require().EqualError(storage.ErrEventDoesNotExist, err.Error())
+	m.Require().Equal(app.KindNotFound, app.KindOf(err))
+}
+
+func (m *Suite) TestEventListSuccess() {
+	list, err := m.store.EventListFilterByStartDate(context.Background(), 3, 10)
+
+	m.Require().NoError(err)
+	m.Require().Len(list, 3)
+	m.Require().Contains(list, *m.event("2"))
+	m.Require().Contains(list, *m.event("3"))
+	m.Require().Contains(list, *m.event("4"))
+}
+
+func (m *Suite) TestEventListWithError() {
+	list, err := m.store.EventListFilterByStartDate(context.Background(), 500, 700)
+
+	m.Require().Error(err)
+	m.Require().EqualError(storage.ErrNoEvents, err.Error())
+	m.Require().Equal(app.KindNotFound, app.KindOf(err))
+	m.Require().Nil(list)
+}
+
+func (m *Suite) TestGetEventSuccess() {
+	event, err := m.store.Event(context.Background(), "2")
+
+	m.Require().NoError(err)
+	m.Require().Equal(*m.event("2"), event)
+}
+
+func (m *Suite) TestGetEventWithError() {
+	_, err := m.store.Event(context.Background(), "NaN")
+
+	m.Require().Error(err)
+	m.Require().EqualError(storage.ErrEventDoesNotExist, err.Error())
+}
+
+func (m *Suite) TestEventHistory() {
+	before := *m.event("1")
+	records := []app.EventHistoryRecord{
+		{EventID: "1", Action: app.EventUpdated, Actor: "actor", Date: 100, Before: &before, After: &before},
+		{EventID: "1", Action: app.EventRemoved, Actor: "actor", Date: 200, Before: &before},
+		{EventID: "2", Action: app.EventRemoved, Actor: "actor", Date: 300},
+	}
+	for _, r := range records {
+		err := m.store.AddEventHistory(context.Background(), r)
+		m.Require().NoError(err)
+	}
+
+	history, err := m.store.EventHistory(context.Background(), "1")
+
+	m.Require().NoError(err)
+	m.Require().Equal(records[:2], history)
+
+	history, err = m.store.EventHistory(context.Background(), "NaN")
+
+	m.Require().NoError(err)
+	m.Require().Empty(history)
+}
+
+func (m *Suite) TestBulkApplyAllOrNothing() {
+	ops := []app.BulkOperation{
+		{Type: app.BulkCreate, Event: app.Event{ID: "6", Title: "Title6"}},
+		{Type: app.BulkUpdate, Event: app.Event{ID: "1", Title: "TitleUpdated"}},
+		{Type: app.BulkDelete, Event: app.Event{ID: "NaN"}},
+		{Type: app.BulkDelete, Event: app.Event{ID: "2"}},
+	}
+
+	results, err := m.store.BulkApply(context.Background(), ops, true)
+
+	m.Require().NoError(err)
+	m.Require().Len(results, 4)
+	m.Require().Equal(app.ErrBulkAborted, results[0].Err)
+	m.Require().Equal(app.ErrBulkAborted, results[1].Err)
+	m.Require().Equal(storage.ErrEventDoesNotExist, results[2].Err)
+	m.Require().Equal(app.ErrBulkAborted, results[3].Err)
+	m.Require().Nil(m.event("6"))
+	m.Require().Equal("Title1", m.event("1").Title)
+	m.Require().NotNil(m.event("2"))
+}
+
+func (m *Suite) TestBulkApplyBestEffort() {
+	ops := []app.BulkOperation{
+		{Type: app.BulkCreate, Event: app.Event{ID: "6", Title: "Title6"}},
+		{Type: app.BulkUpdate, Event: app.Event{ID: "6", Title: "Title6Updated"}},
+		{Type: app.BulkCreate, Event: app.Event{ID: "1", Title: "Title1"}},
+		{Type: app.BulkDelete, Event: app.Event{ID: "2"}},
+		{Type: "merge", Event: app.Event{ID: "3"}},
+	}
+
+	results, err := m.store.BulkApply(context.Background(), ops, false)
+
+	m.Require().NoError(err)
+	m.Require().Len(results, 5)
+	m.Require().NoError(results[0].Err)
+	m.Require().NoError(results[1].Err)
+	m.Require().Equal("Title6", results[1].Before.Title)
+	m.Require().Equal(storage.ErrEventAlreadyExist, results[2].Err)
+	m.Require().NoError(results[3].Err)
+	m.Require().Equal("Title2", results[3].Before.Title)
+	m.Require().Equal(app.ErrBulkUnknownOperation, results[4].Err)
+	m.Require().Equal("Title6Updated", m.event("6").Title)
+	m.Require().Nil(m.event("2"))
+}
+
+func (m *Suite) TestBulkApplyRequireOwner() {
+	ctx := context.Background()
+	owned := app.Event{ID: "6", Title: "Title6", OwnerID: "user_1"}
+	results, err := m.store.BulkApply(ctx, []app.BulkOperation{{Type: app.BulkCreate, Event: owned, RequireOwner: "user_2"}}, true)
+	m.Require().NoError(err)
+	m.Require().NoError(results[0].Err)
+
+	updated := owned
+	updated.Title = "Title6Updated"
+	for _, op := range []app.BulkOperation{
+		{Type: app.BulkUpdate, Event: updated, RequireOwner: "user_2"},
+		{Type: app.BulkDelete, Event: app.Event{ID: "6"}, RequireOwner: "user_2"},
+	} {
+		results, err = m.store.BulkApply(ctx, []app.BulkOperation{op}, true)
+		m.Require().NoError(err)
+		m.Require().Equal(app.ErrNotEventOwner, results[0].Err)
+	}
+	m.Require().Equal(owned, *m.event("6"))
+
+	results, err = m.store.BulkApply(ctx, []app.BulkOperation{{Type: app.BulkUpdate, Event: updated, RequireOwner: "user_1"}}, true)
+	m.Require().NoError(err)
+	m.Require().NoError(results[0].Err)
+	m.Require().Equal(owned, *results[0].Before)
+}
+
+func (m *Suite) TestUserTimezone() {
+	ctx := context.Background()
+
+	tz, err := m.store.UserTimezone(ctx, "unique_owner_uid")
+	m.Require().NoError(err)
+	m.Require().Empty(tz)
+
+	m.Require().NoError(m.store.SetUserTimezone(ctx, "unique_owner_uid", "Asia/Tokyo"))
+	tz, err = m.store.UserTimezone(ctx, "unique_owner_uid")
+	m.Require().NoError(err)
+	m.Require().Equal("Asia/Tokyo", tz)
+}
+
+func (m *Suite) TestEventListFilterByPeriod() {
+	ctx := context.Background()
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "multi_day", StartDate: 1, EndDate: 30}))
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "instant", StartDate: 20, EndDate: 20}))
+
+	list, err := m.store.EventListFilterByPeriod(ctx, 20, 25)
+	m.Require().NoError(err)
+	ids := make([]string, 0, len(list))
+	for _, e := range list {
+		ids = append(ids, e.ID)
+	}
+	m.Require().ElementsMatch([]string{"2", "multi_day", "instant"}, ids)
+
+	list, err = m.store.EventListFilterByPeriod(ctx, 30, 40)
+	m.Require().Error(err)
+	m.Require().Nil(list)
+}
+
+func (m *Suite) TestEventListFilterByPeriodBounds() {
+	ctx := context.Background()
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "first_second", StartDate: math.MinInt64}))
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "last_second", StartDate: math.MaxInt64}))
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "till_end", StartDate: math.MaxInt64 - 10, EndDate: math.MaxInt64}))
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "forever", StartDate: math.MinInt64, EndDate: math.MaxInt64}))
+
+	ids := func(from, to int64) []string {
+		list, err := m.store.EventListFilterByPeriod(ctx, from, to)
+		m.Require().NoError(err)
+		ids := make([]string, 0, len(list))
+		for _, e := range list {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	// end is exclusive, so only an instant event covers the last second
+	m.Require().ElementsMatch([]string{"last_second"}, ids(math.MaxInt64, math.MaxInt64))
+	m.Require().ElementsMatch([]string{"last_second", "till_end", "forever"}, ids(math.MaxInt64-5, math.MaxInt64))
+	m.Require().ElementsMatch([]string{"first_second", "forever"}, ids(math.MinInt64, math.MinInt64))
+
+	list, err := m.store.EventListFilterByStartDate(ctx, math.MaxInt64, math.MaxInt64)
+	m.Require().NoError(err)
+	m.Require().Len(list, 1)
+	m.Require().Equal("last_second", list[0].ID)
+}
+
+func (m *Suite) TestIndexesFollowUpdates() {
+	ctx := context.Background()
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "6", StartDate: 1000, EndDate: 1030}))
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "7", StartDate: 1040, EndDate: 1050}))
+
+	list, err := m.store.EventListFilterByPeriod(ctx, 1020, 1045)
+	m.Require().NoError(err)
+	m.Require().Len(list, 2)
+	m.Require().Equal("6", list[0].ID)
+	m.Require().Equal("7", list[1].ID)
+
+	// indexes follow the dates of the updated event
+	m.Require().NoError(m.store.UpdateEvent(ctx, app.Event{ID: "6", StartDate: 1100, EndDate: 1200}))
+	list, err = m.store.EventListFilterByPeriod(ctx, 1000, 1099)
+	m.Require().NoError(err)
+	m.Require().Len(list, 1)
+	m.Require().Equal("7", list[0].ID)
+
+	list, err = m.store.EventListFilterByStartDate(ctx, 1100, 1100)
+	m.Require().NoError(err)
+	m.Require().Len(list, 1)
+	m.Require().Equal("6", list[0].ID)
+
+	m.Require().NoError(m.store.RemoveEvent(ctx, "7"))
+	_, err = m.store.EventListFilterByPeriod(ctx, 1000, 1099)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+}
+
+func (m *Suite) TestAsyncOperations() {
+	ctx := context.Background()
+	toUpdate := app.Event{
+		ID:          "1",
+		Title:       "TitleUpdate",
+		StartDate:   1,
+		EndDate:     2,
+		Description: "DescriptionUpdate",
+		OwnerID:     "",
+		RemindIn:    5,
+	}
+
+	// suite assertions must not be called from other goroutines, so they report into channels
+	var wg sync.WaitGroup
+	errs := make(chan error, 13)
+	lists := make(chan []app.Event, 1)
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 10; i < 20; i++ {
+			errs <- m.store.NewEvent(ctx, app.Event{ID: fmt.Sprint(i), Title: fmt.Sprintf("Title%d", i)})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs <- m.store.UpdateEvent(ctx, toUpdate)
+	}()
+
+	go func() {
+		defer wg.Done()
+		// events 3 and 4 are not touched by other goroutines, so the result doesn't depend on the order
+		list, err := m.store.EventListFilterByStartDate(ctx, 6, 10)
+		errs <- err
+		lists <- list
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs <- m.store.RemoveEvent(ctx, "5")
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		m.Require().NoError(err)
+	}
+	m.Require().Len(<-lists, 2)
+
+	for i := 10; i < 20; i++ {
+		e, err := m.store.Event(ctx, fmt.Sprint(i))
+		m.Require().NoError(err)
+		m.Require().Equal(fmt.Sprintf("Title%d", i), e.Title)
+	}
+	updated, err := m.store.Event(ctx, "1")
+	m.Require().NoError(err)
+	m.Require().Equal(toUpdate.Title, updated.Title)
+	m.Require().Equal(toUpdate.Description, updated.Description)
+	_, err = m.store.Event(ctx, "5")
+	m.Require().True(errors.Is(err, storage.ErrEventDoesNotExist))
+}
+
+func (m *Suite) TestNotFound() {
+	ctx := context.Background()
+
+	_, err := m.store.Event(ctx, "NaN")
+	m.Require().True(errors.Is(err, storage.ErrEventDoesNotExist))
+
+	err = m.store.UpdateEvent(ctx, app.Event{ID: "NaN"})
+	m.Require().True(errors.Is(err, storage.ErrEventDoesNotExist))
+
+	err = m.store.RemoveEvent(ctx, "NaN")
+	m.Require().True(errors.Is(err, storage.ErrEventDoesNotExist))
+
+	err = m.store.RemoveWebhook(ctx, "NaN")
+	m.Require().True(errors.Is(err, storage.ErrWebhookDoesNotExist))
+
+	_, err = m.store.WebhookDeliveries(ctx, "NaN")
+	m.Require().True(errors.Is(err, storage.ErrWebhookDoesNotExist))
+}
+
+func (m *Suite) TestNoEventsOnEmptyRange() {
+	ctx := context.Background()
+
+	list, err := m.store.EventListFilterByStartDate(ctx, 500, 700)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+	m.Require().Nil(list)
+
+	list, err = m.store.EventListFilterByReminderIn(ctx, 500, 700)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+	m.Require().Nil(list)
+
+	list, err = m.store.EventListFilterByPeriod(ctx, 500, 700)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+	m.Require().Nil(list)
+
+	// inverted window is not an error of the query itself
+	list, err = m.store.EventListFilterByPeriod(ctx, 20, 10)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+	m.Require().Nil(list)
+}
+
+func (m *Suite) TestBoundaries() {
+	ctx := context.Background()
+
+	list, err := m.store.EventListFilterByStartDate(ctx, 5, 10)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"2", "3", "4"}, ids(list))
+
+	list, err = m.store.EventListFilterByReminderIn(ctx, 5, 5)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"1"}, ids(list))
+
+	// event 4 lasts [10, 12), event 5 lasts [15, 20), both bounds of the window are included
+	list, err = m.store.EventListFilterByPeriod(ctx, 12, 14)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"2", "3"}, ids(list))
+
+	list, err = m.store.EventListFilterByPeriod(ctx, 12, 15)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"2", "3", "5"}, ids(list))
+
+	list, err = m.store.EventListFilterByPeriod(ctx, 11, 16)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"2", "3", "4", "5"}, ids(list))
+
+	// instant event is one second long
+	m.Require().NoError(m.store.NewEvent(ctx, app.Event{ID: "6", StartDate: 100, EndDate: 100}))
+	list, err = m.store.EventListFilterByPeriod(ctx, 100, 100)
+	m.Require().NoError(err)
+	m.Require().ElementsMatch([]string{"6"}, ids(list))
+
+	_, err = m.store.EventListFilterByPeriod(ctx, 101, 200)
+	m.Require().True(errors.Is(err, storage.ErrNoEvents))
+}
+
+func (m *Suite) TestWebhooks() {
+	ctx := context.Background()
+	webhook := app.Webhook{
+		ID:      "1",
+		URL:     "http://localhost/hook",
+		Secret:  "secret",
+		Actions: []app.EventAction{app.EventCreated},
+		UserID:  "user_1",
+	}
+
+	webhooks, err := m.store.Webhooks(ctx)
+	m.Require().NoError(err)
+	m.Require().Empty(webhooks)
+
+	m.Require().NoError(m.store.NewWebhook(ctx, webhook))
+	err = m.store.NewWebhook(ctx, webhook)
+	m.Require().True(errors.Is(err, storage.ErrWebhookAlreadyExist))
+
+	webhooks, err = m.store.Webhooks(ctx)
+	m.Require().NoError(err)
+	m.Require().Equal([]app.Webhook{webhook}, webhooks)
+
+	deliveries := []app.WebhookDelivery{
+		{WebhookID: "1", DeliveryID: "1-1", EventID: "1", Action: app.EventCreated, Attempt: 1, StatusCode: 500, Error: "failed"},
+		{WebhookID: "1", DeliveryID: "1-1", EventID: "1", Action: app.EventCreated, Attempt: 2, StatusCode: 200, Success: true},
+	}
+	for _, d := range deliveries {
+		m.Require().NoError(m.store.AddWebhookDelivery(ctx, d))
+	}
+	saved, err := m.store.WebhookDeliveries(ctx, "1")
+	m.Require().NoError(err)
+	m.Require().Equal(deliveries, saved)
+
+	m.Require().NoError(m.store.RemoveWebhook(ctx, "1"))
+	webhooks, err = m.store.Webhooks(ctx)
+	m.Require().NoError(err)
+	m.Require().Empty(webhooks)
+}
+
+func (m *Suite) TestConcurrentWrites() {
+	ctx := context.Background()
+	const workers, perWorker = 8, 25
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = m.writeEvents(ctx, w, perWorker)
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		m.Require().NoError(err)
+	}
+
+	list, err := m.store.EventListFilterByStartDate(ctx, 1000, 2000)
+	m.Require().NoError(err)
+	m.Require().Len(list, workers*perWorker)
+	for _, e := range list {
+		m.Require().Equal("updated", e.Title)
+	}
+}
+
+// writeEvents returns the first error instead of asserting, suite assertions must not be called from other goroutines.
+func (m *Suite) writeEvents(ctx context.Context, worker, count int) error {
+	for i := 0; i < count; i++ {
+		e := app.Event{ID: fmt.Sprintf("w%d_%d", worker, i), StartDate: 1000 + int64(i), EndDate: 2000}
+		if err := m.store.NewEvent(ctx, e); err != nil {
+			return err
+		}
+
+		e.Title = "updated"
+		if err := m.store.UpdateEvent(ctx, e); err != nil {
+			return err
+		}
+
+		if _, err := m.store.EventListFilterByPeriod(ctx, 1000, 2000); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ids(events []app.Event) []string {
+	result := make([]string, len(events))
+	for i, e := range events {
+		result[i] = e.ID
+	}
+	return result
+}
@@ -102,7 +102,13 @@ func (s *IntegrationSuite) notificationIsExist(eventID string) bool {
 
 func (s *IntegrationSuite) getEvent(id string) (app.Event, error) {
 	var event app.Event
-	err := s.db.Get(&event, "SELECT * FROM event WHERE id=$1", id)
+	err := s.db.Get(
+		&event,
+		`SELECT id, title, start_date, end_date, description, owner_id, remind_in, timezone, all_day, start_day, end_day
+			FROM event
+			WHERE id=$1`,
+		id,
+	)
 	return event, err
 }
 
@@ -164,7 +170,7 @@ func (s *IntegrationSuite) TestCreateEventFail() {
 	resp, err := http.Post(restURL+"/event/create", "application/json", bytes.NewReader(data))
 
 	s.Require().NoError(err)
-	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Require().Equal(http.StatusConflict, resp.StatusCode)
 }
 
 func (s *IntegrationSuite) TestUpdateEventSuccess() {
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/cmd/config"
+	"github.com/nsmak/otus_hw/hw12_13_14_15_calendar/internal/app"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/nsmak/otus_hw/hw12_13_14_15_calendar"
+
+type Error struct {
+	app.BaseError
+}
+
+func NewError(msg string, err error) *Error {
+	return &Error{BaseError: app.BaseError{Message: msg, Err: err}}
+}
+
+var ErrUnknownExporter = NewError("unknown span exporter", nil)
+
+// Provider owns the global tracer provider, spans are dropped until it's started.
+type Provider struct {
+	tp     *sdktrace.TracerProvider
+	closer io.Closer
+}
+
+// New installs the global tracer provider passing spans of service to processor,
+// the trace context is propagated in w3c traceparent headers.
+func New(service string, processor sdktrace.SpanProcessor, sampleRatio float64) *Provider {
+	sampler := sdktrace.AlwaysSample()
+	if sampleRatio > 0 && sampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return &Provider{tp: tp}
+}
+
+// Start creates the exporter from config, it returns nil provider when tracing is disabled.
+func Start(ctx context.Context, service string, cfg config.TracingConf) (*Provider, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch cfg.Exporter {
+	case "":
+		return nil, nil
+	case config.ExporterStdout:
+		var w io.Writer = os.Stdout
+		if cfg.Endpoint != "" {
+			f, err := os.OpenFile(cfg.Endpoint, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, NewError("can't open span file", err)
+			}
+			w, closer = f, f
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case config.ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, ErrUnknownExporter
+	}
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, NewError("can't create span exporter", err)
+	}
+
+	p := New(service, sdktrace.NewBatchSpanProcessor(exporter), cfg.SampleRatio)
+	p.closer = closer
+	return p, nil
+}
+
+// Shutdown flushes buffered spans, it's safe to call on nil provider.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	err := p.tp.Shutdown(ctx)
+	if p.closer != nil {
+		p.closer.Close()
+	}
+	if err != nil {
+		return NewError("can't flush spans", err)
+	}
+	return nil
+}
+
+// Tracer returns the tracer of the global provider, so spans of packages are not bound to the start order.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// End marks span failed with err if any and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS  event_history (
+    id bigserial NOT NULL,
+    event_id varchar(36) NOT NULL,
+    action varchar(16) NOT NULL,
+    actor varchar(36) NOT NULL DEFAULT '',
+    date bigint NOT NULL,
+    before jsonb,
+    after jsonb,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS event_history_event_id_idx ON event_history (event_id);
+
+-- +goose Down
+drop table event_history;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS  webhook (
+    id varchar(36) NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL DEFAULT '',
+    actions jsonb NOT NULL DEFAULT '[]',
+    owner_id varchar(36) NOT NULL DEFAULT '',
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS  webhook_delivery (
+    id bigserial NOT NULL,
+    webhook_id varchar(36) NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    delivery_id varchar(64) NOT NULL,
+    event_id varchar(36) NOT NULL,
+    action varchar(16) NOT NULL,
+    attempt integer NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    success boolean NOT NULL DEFAULT false,
+    date bigint NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id);
+
+-- +goose Down
+drop table webhook_delivery;
+drop table webhook;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE event
+    ALTER COLUMN start_date TYPE bigint,
+    ALTER COLUMN end_date TYPE bigint,
+    ALTER COLUMN remind_in TYPE bigint,
+    ADD COLUMN IF NOT EXISTS timezone varchar(64) NOT NULL DEFAULT '';
+
+ALTER TABLE notification
+    ALTER COLUMN start_date TYPE bigint;
+
+CREATE TABLE IF NOT EXISTS  user_settings (
+    user_id varchar(36) NOT NULL,
+    timezone varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id)
+);
+
+-- +goose Down
+drop table user_settings;
+
+ALTER TABLE notification
+    ALTER COLUMN start_date TYPE integer;
+
+ALTER TABLE event
+    DROP COLUMN timezone,
+    ALTER COLUMN start_date TYPE integer,
+    ALTER COLUMN end_date TYPE integer,
+    ALTER COLUMN remind_in TYPE integer;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- start_day and end_day are YYYY-MM-DD calendar dates, empty for regular events
+ALTER TABLE event
+    ADD COLUMN IF NOT EXISTS all_day boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS start_day varchar(10) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS end_day varchar(10) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE event
+    DROP COLUMN all_day,
+    DROP COLUMN start_day,
+    DROP COLUMN end_day;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- instant events are stored as one second long, empty range never overlaps anything
+ALTER TABLE event
+    ADD COLUMN IF NOT EXISTS period int8range
+        GENERATED ALWAYS AS (int8range(start_date, GREATEST(end_date, start_date + 1))) STORED;
+
+CREATE INDEX IF NOT EXISTS event_period_idx ON event USING gist (period);
+
+-- +goose Down
+DROP INDEX IF EXISTS event_period_idx;
+
+ALTER TABLE event
+    DROP COLUMN period;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE webhook ADD COLUMN IF NOT EXISTS user_id varchar(36) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS webhook_user_id_idx ON webhook (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS webhook_user_id_idx;
+ALTER TABLE webhook DROP COLUMN IF EXISTS user_id;
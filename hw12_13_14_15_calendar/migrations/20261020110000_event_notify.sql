@@ -0,0 +1,30 @@
+-- +goose Up
+-- every change of event is announced to the listeners of event_changes, the calendar cache drops ranges by it,
+-- the payload keeps only the fields the ranges depend on, notify payload is limited to 8000 bytes
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_event_change() RETURNS trigger AS $$
+DECLARE
+    before json;
+    after json;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        before := json_build_object('id', OLD.id, 'start_date', OLD.start_date, 'end_date', OLD.end_date,
+            'remind_in', OLD.remind_in);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        after := json_build_object('id', NEW.id, 'start_date', NEW.start_date, 'end_date', NEW.end_date,
+            'remind_in', NEW.remind_in);
+    END IF;
+    PERFORM pg_notify('event_changes', json_build_object('before', before, 'after', after)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS event_notify ON event;
+CREATE TRIGGER event_notify AFTER INSERT OR UPDATE OR DELETE ON event
+    FOR EACH ROW EXECUTE PROCEDURE notify_event_change();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS event_notify ON event;
+DROP FUNCTION IF EXISTS notify_event_change();
@@ -0,0 +1,25 @@
+-- +goose Up
+-- int8range can't include the second math.MaxInt64 and fails on start_date + 1 for it,
+-- numrange keeps the same half-open period for the whole bigint range
+DROP INDEX IF EXISTS event_period_idx;
+
+ALTER TABLE event
+    DROP COLUMN IF EXISTS period;
+
+ALTER TABLE event
+    ADD COLUMN period numrange
+        GENERATED ALWAYS AS (numrange(start_date, GREATEST(end_date, start_date::numeric + 1))) STORED;
+
+CREATE INDEX IF NOT EXISTS event_period_idx ON event USING gist (period);
+
+-- +goose Down
+DROP INDEX IF EXISTS event_period_idx;
+
+ALTER TABLE event
+    DROP COLUMN period;
+
+ALTER TABLE event
+    ADD COLUMN period int8range
+        GENERATED ALWAYS AS (int8range(start_date, GREATEST(end_date, start_date + 1))) STORED;
+
+CREATE INDEX IF NOT EXISTS event_period_idx ON event USING gist (period);